@@ -0,0 +1,114 @@
+// Package cache holds finished responses in memory, evicting the least
+// recently used once the bodies outgrow a size bound.
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tim-harding/fatal-encounters-server/query"
+)
+
+// Entry is a stored response
+type Entry struct {
+	// Version is the dataset version the response was made from
+	Version int
+	Status  int
+	Header  http.Header
+	Body    []byte
+}
+
+type item struct {
+	key    string
+	entry  *Entry
+	stored time.Time
+}
+
+// Cache is safe for concurrent use
+type Cache struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	maxBytes int
+	maxEntry int
+	bytes    int
+	items    map[string]*list.Element
+	// order has the most recently used item at the front
+	order *list.List
+	now   func() time.Time
+}
+
+// New creates a cache holding up to maxBytes of bodies, each for at most ttl
+// and of at most maxEntry bytes. maxEntry is capped at maxBytes.
+func New(maxBytes, maxEntry int, ttl time.Duration) *Cache {
+	if maxEntry <= 0 || maxEntry > maxBytes {
+		maxEntry = maxBytes
+	}
+	return &Cache{
+		ttl:      ttl,
+		maxBytes: maxBytes,
+		maxEntry: maxEntry,
+		items:    map[string]*list.Element{},
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// MaxEntryBytes is the largest body the cache will store
+func (c *Cache) MaxEntryBytes() int {
+	return c.maxEntry
+}
+
+// Get finds an entry that has not expired
+func (c *Cache) Get(key string) (*Entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	it := element.Value.(*item)
+	if c.now().Sub(it.stored) >= c.ttl {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return it.entry, true
+}
+
+// Add stores an entry, replacing any under the same key. Entries
+// larger than MaxEntryBytes are not stored.
+func (c *Cache) Add(key string, entry *Entry) {
+	size := len(entry.Body)
+	if size > c.maxEntry {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		c.remove(element)
+	}
+	for c.bytes+size > c.maxBytes {
+		c.remove(c.order.Back())
+	}
+	c.items[key] = c.order.PushFront(&item{key, entry, c.now()})
+	c.bytes += size
+}
+
+func (c *Cache) remove(element *list.Element) {
+	it := c.order.Remove(element).(*item)
+	delete(c.items, it.key)
+	c.bytes -= len(it.entry.Body)
+}
+
+// Key identifies a response by the request path, the query string with
+// its keys sorted, and the SQL and parameters of the query that answers it
+func Key(r *http.Request, q query.Clauser) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%#v", r.URL.Path, r.URL.Query().Encode(), q.String(), q.Parameters())
+	return hex.EncodeToString(h.Sum(nil))
+}
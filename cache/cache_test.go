@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/tim-harding/fatal-encounters-server/query"
+)
+
+func entryOf(body string) *Entry {
+	return &Entry{Status: 200, Body: []byte(body)}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New(6, 6, time.Minute)
+	c.Add("a", entryOf("aa"))
+	c.Add("b", entryOf("bb"))
+	c.Add("c", entryOf("cc"))
+	c.Get("a")
+	c.Add("d", entryOf("dd"))
+	if _, ok := c.Get("b"); ok {
+		t.Errorf("Was cached;\nWant b evicted")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Was evicted;\nWant %s cached", key)
+		}
+	}
+}
+
+func TestSkipsOversizedEntries(t *testing.T) {
+	c := New(10, 2, time.Minute)
+	c.Add("a", entryOf("abc"))
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Was cached;\nWant entry larger than the entry size skipped")
+	}
+	c.Add("b", entryOf("bc"))
+	if _, ok := c.Get("b"); !ok {
+		t.Errorf("Was skipped;\nWant b cached")
+	}
+}
+
+func TestExpiresEntries(t *testing.T) {
+	c := New(10, 10, time.Minute)
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	c.Add("a", entryOf("a"))
+	now = now.Add(time.Minute)
+	if _, ok := c.Get("a"); ok {
+		t.Errorf("Was cached;\nWant expired")
+	}
+	if c.bytes != 0 {
+		t.Errorf("Was %d bytes;\nWant 0", c.bytes)
+	}
+}
+
+func TestKeySortsQueryString(t *testing.T) {
+	q := query.NewSelectClause("race", []string{"id"})
+	a := Key(httptest.NewRequest("GET", "/race/?count=2&page=1", nil), q)
+	b := Key(httptest.NewRequest("GET", "/race/?page=1&count=2", nil), q)
+	if a != b {
+		t.Errorf("Was `%s`;\nWant `%s`", a, b)
+	}
+	c := Key(httptest.NewRequest("GET", "/city/?page=1&count=2", nil), q)
+	if a == c {
+		t.Errorf("Was the same key;\nWant different keys for different paths")
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+// agencyHeader is the expected header of an agencies CSV.
+// Empty fields leave what is already known about the agency.
+var agencyHeader = []string{"name", "state", "type", "ori", "parent"}
+
+// agencyTypePhrases are words in agency names that give away their type,
+// checked in order so that "U.S. Marshals" isn't taken for a sheriff. Only
+// phrases specific to one type are listed; names matching none are left
+// without a type for an agencies CSV to fill in.
+var agencyTypePhrases = []struct {
+	Type    string
+	Phrases []string
+}{
+	{"federal", []string{
+		"united states", "u s marshals", "us marshals", "federal bureau of investigation", "fbi",
+		"drug enforcement administration", "dea", "bureau of alcohol tobacco firearms and explosives", "atf",
+		"marshals service", "border patrol", "customs and border protection", "immigration and customs enforcement",
+	}},
+	{"state", []string{"state police", "state patrol", "highway patrol", "state troopers"}},
+	{"sheriff", []string{"sheriff", "sheriffs"}},
+	{"municipal", []string{"police department", "police dept", "police bureau"}},
+}
+
+const (
+	// Agencies are keyed by name and state, which is NULL for federal
+	// agencies. Types guessed from names give way to later guesses, so
+	// better phrases fix earlier mistakes, but never to a type from a CSV.
+	sqlUpsertIncidentAgency = `
+		INSERT INTO agency (name, state_id, type, type_guessed)
+		VALUES ($1, $2, $3, $3::TEXT IS NOT NULL)
+		ON CONFLICT (name, COALESCE(state_id, 0)) DO UPDATE SET
+			type = CASE
+				WHEN agency.type IS NULL OR agency.type_guessed THEN EXCLUDED.type
+				ELSE agency.type
+			END,
+			type_guessed = CASE
+				WHEN agency.type IS NULL OR agency.type_guessed THEN EXCLUDED.type_guessed
+				ELSE FALSE
+			END
+		RETURNING id
+	`
+	sqlUpsertAgency = `
+		INSERT INTO agency (name, state_id, type, ori, parent_id)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name, COALESCE(state_id, 0)) DO UPDATE SET
+			type = COALESCE(EXCLUDED.type, agency.type),
+			type_guessed = EXCLUDED.type IS NULL AND agency.type_guessed,
+			ori = COALESCE(EXCLUDED.ori, agency.ori),
+			parent_id = COALESCE(EXCLUDED.parent_id, agency.parent_id)
+	`
+	// Parents are found by name in the state of the agency naming them
+	sqlUpsertParentAgency = `
+		INSERT INTO agency (name, state_id)
+		VALUES ($1, $2)
+		ON CONFLICT (name, COALESCE(state_id, 0)) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id
+	`
+	sqlDeleteIncidentAgencies = `DELETE FROM incident_agency WHERE incident_id = $1`
+	sqlInsertIncidentAgency   = `
+		INSERT INTO incident_agency (incident_id, agency_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`
+)
+
+// normalizeAgencyName lowercases the name and separates its words by single
+// spaces, with a space on either end to match whole words against
+func normalizeAgencyName(name string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return " " + strings.Join(words, " ") + " "
+}
+
+// inferAgencyType guesses the type of an agency from its name,
+// or nil if nothing in the name gives it away
+func inferAgencyType(name string) *string {
+	normalized := normalizeAgencyName(name)
+	for _, candidate := range agencyTypePhrases {
+		for _, phrase := range candidate.Phrases {
+			if strings.Contains(normalized, " "+phrase+" ") {
+				agencyType := candidate.Type
+				return &agencyType
+			}
+		}
+	}
+	return nil
+}
+
+// agencyRecord is one row of an agencies CSV
+type agencyRecord struct {
+	Name   string
+	State  *string
+	Type   *string
+	ORI    *string
+	Parent *string
+}
+
+func parseAgency(values []string) (agencyRecord, error) {
+	rec := agencyRecord{}
+	if len(values) != len(agencyHeader) {
+		return rec, fmt.Errorf("expected %d fields, got %d", len(agencyHeader), len(values))
+	}
+	rec.Name = strings.TrimSpace(values[0])
+	if rec.Name == "" {
+		return rec, fmt.Errorf("missing name")
+	}
+	rec.State = parseText(strings.ToUpper(strings.TrimSpace(values[1])))
+	if rec.State != nil {
+		if _, ok := stateNames[*rec.State]; !ok {
+			return rec, fmt.Errorf("unknown state %q", *rec.State)
+		}
+	}
+	rec.Type = parseText(strings.ToLower(strings.TrimSpace(values[2])))
+	if rec.Type != nil && !shared.IsAgencyType(*rec.Type) {
+		return rec, fmt.Errorf("type %q is not one of %s", *rec.Type, strings.Join(shared.AgencyTypes, ", "))
+	}
+	rec.ORI = parseText(strings.ToUpper(strings.TrimSpace(values[3])))
+	rec.Parent = parseText(strings.TrimSpace(values[4]))
+	if rec.Parent != nil && *rec.Parent == rec.Name {
+		return rec, fmt.Errorf("agency %q can't be its own parent", rec.Name)
+	}
+	return rec, nil
+}
+
+// importAgencies loads what is known about agencies, adding any not yet
+// named by an incident. Parents are added by name and state if need be.
+func importAgencies(db *sql.DB, r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return 0, err
+	}
+	if strings.Join(header, ",") != strings.Join(agencyHeader, ",") {
+		return 0, fmt.Errorf("expected header %s", strings.Join(agencyHeader, ","))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	upsert, err := tx.Prepare(sqlUpsertAgency)
+	if err != nil {
+		return 0, err
+	}
+	defer upsert.Close()
+	state, err := newStateLookup(tx)
+	if err != nil {
+		return 0, err
+	}
+	defer state.Close()
+	parent, err := newLookup(tx, sqlUpsertParentAgency)
+	if err != nil {
+		return 0, err
+	}
+	defer parent.Close()
+
+	count := 0
+	for line := 2; ; line++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		rec, err := parseAgency(values)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		var stateID *int
+		if rec.State != nil {
+			id, err := state.id(*rec.State, stateNames[*rec.State])
+			if err != nil {
+				return 0, err
+			}
+			stateID = &id
+		}
+		parentID, err := parent.maybeID(rec.Parent, stateID)
+		if err != nil {
+			return 0, err
+		}
+		_, err = upsert.Exec(rec.Name, stateID, rec.Type, rec.ORI, parentID)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		count++
+	}
+
+	_, err = tx.Exec(sqlBumpVersion)
+	if err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
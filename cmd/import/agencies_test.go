@@ -0,0 +1,51 @@
+package main
+
+import "testing"
+
+func TestInfersAgencyType(t *testing.T) {
+	for name, wanted := range map[string]string{
+		"Portland Police Bureau":            "municipal",
+		"Multnomah County Sheriff's Office": "sheriff",
+		"U.S. Marshals Service":             "federal",
+		"California Highway Patrol":         "state",
+		"Washington County Sheriff, US DEA": "federal",
+	} {
+		was := inferAgencyType(name)
+		if was == nil || *was != wanted {
+			t.Errorf("%s: Was %v;\nWant %s", name, was, wanted)
+		}
+	}
+	for _, name := range []string{"Pdx Transit", "Texas Department of Public Safety", "University PD", "US Park Rangers"} {
+		if was := inferAgencyType(name); was != nil {
+			t.Errorf("%s: Was %s;\nWant nil", name, *was)
+		}
+	}
+}
+
+func TestParsesAgency(t *testing.T) {
+	rec, err := parseAgency([]string{"Portland Police Bureau", "or", "Municipal", "or0260200", ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Name != "Portland Police Bureau" || *rec.State != "OR" || *rec.Type != "municipal" || *rec.ORI != "OR0260200" || rec.Parent != nil {
+		t.Errorf("Unexpected record %+v", rec)
+	}
+}
+
+func TestRejectsUnknownAgencyType(t *testing.T) {
+	_, err := parseAgency([]string{"Portland Police Bureau", "OR", "city", "", ""})
+	if err == nil {
+		t.Error("Expected an error for an unknown type")
+	}
+}
+
+func TestLookupKeyUsesValues(t *testing.T) {
+	a, b := 5, 5
+	if lookupKey([]interface{}{"Springfield Police Department", &a}) != lookupKey([]interface{}{"Springfield Police Department", &b}) {
+		t.Error("Was different keys;\nWant the same key for equal states")
+	}
+	var none *int
+	if lookupKey([]interface{}{"FBI", none}) == lookupKey([]interface{}{"FBI", &a}) {
+		t.Error("Was the same key;\nWant different keys for different states")
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"database/sql"
+)
+
+const sqlUpsertIncident = `
+	INSERT INTO incident (
+		id,
+		name,
+		age,
+		date,
+		image_url,
+		is_male,
+		address,
+		description,
+		article_url,
+		video_url,
+		zipcode,
+		latitude,
+		longitude,
+		cause_id,
+		use_of_force_id,
+		race_id,
+		county_id,
+		agency_id,
+		city_id,
+		state_id
+	)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+	ON CONFLICT (id) DO UPDATE SET
+		name = EXCLUDED.name,
+		age = EXCLUDED.age,
+		date = EXCLUDED.date,
+		image_url = EXCLUDED.image_url,
+		is_male = EXCLUDED.is_male,
+		address = EXCLUDED.address,
+		description = EXCLUDED.description,
+		article_url = EXCLUDED.article_url,
+		video_url = EXCLUDED.video_url,
+		zipcode = EXCLUDED.zipcode,
+		latitude = EXCLUDED.latitude,
+		longitude = EXCLUDED.longitude,
+		cause_id = EXCLUDED.cause_id,
+		use_of_force_id = EXCLUDED.use_of_force_id,
+		race_id = EXCLUDED.race_id,
+		county_id = EXCLUDED.county_id,
+		agency_id = EXCLUDED.agency_id,
+		city_id = EXCLUDED.city_id,
+		state_id = EXCLUDED.state_id
+`
+
+// loader writes parsed records into the incident and lookup tables
+type loader struct {
+	incident   *sql.Stmt
+	unlink     *sql.Stmt
+	link       *sql.Stmt
+	state      *lookup
+	city       *lookup
+	county     *lookup
+	agency     *lookup
+	cause      *lookup
+	race       *lookup
+	useOfForce *lookup
+}
+
+func newLoader(tx *sql.Tx) (*loader, error) {
+	l := &loader{}
+	var err error
+	if l.incident, err = tx.Prepare(sqlUpsertIncident); err != nil {
+		return nil, err
+	}
+	if l.unlink, err = tx.Prepare(sqlDeleteIncidentAgencies); err != nil {
+		return nil, err
+	}
+	if l.link, err = tx.Prepare(sqlInsertIncidentAgency); err != nil {
+		return nil, err
+	}
+	if l.state, err = newStateLookup(tx); err != nil {
+		return nil, err
+	}
+	if l.city, err = newStateEnumLookup(tx, "city"); err != nil {
+		return nil, err
+	}
+	if l.county, err = newStateEnumLookup(tx, "county"); err != nil {
+		return nil, err
+	}
+	if l.agency, err = newLookup(tx, sqlUpsertIncidentAgency); err != nil {
+		return nil, err
+	}
+	if l.cause, err = newEnumLookup(tx, "cause"); err != nil {
+		return nil, err
+	}
+	if l.race, err = newEnumLookup(tx, "race"); err != nil {
+		return nil, err
+	}
+	if l.useOfForce, err = newEnumLookup(tx, "use_of_force"); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *loader) load(rec record) error {
+	stateID, err := l.state.id(rec.State, stateNames[rec.State])
+	if err != nil {
+		return err
+	}
+	cityID, err := l.city.maybeID(rec.City, stateID)
+	if err != nil {
+		return err
+	}
+	countyID, err := l.county.maybeID(rec.County, stateID)
+	if err != nil {
+		return err
+	}
+	agencyIDs := []int{}
+	for _, name := range rec.Agencies {
+		id, err := l.agency.id(name, agencyStateID(name, stateID), inferAgencyType(name))
+		if err != nil {
+			return err
+		}
+		agencyIDs = append(agencyIDs, id)
+	}
+	// The first agency listed is the one responsible
+	var agencyID *int
+	if len(agencyIDs) > 0 {
+		agencyID = &agencyIDs[0]
+	}
+	raceID, err := l.race.maybeID(rec.Race)
+	if err != nil {
+		return err
+	}
+	causeID, err := l.cause.id(rec.Cause)
+	if err != nil {
+		return err
+	}
+	useOfForceID, err := l.useOfForce.id(rec.UseOfForce)
+	if err != nil {
+		return err
+	}
+	_, err = l.incident.Exec(
+		rec.ID,
+		rec.Name,
+		rec.Age,
+		rec.Date,
+		rec.ImageURL,
+		rec.IsMale,
+		rec.Address,
+		rec.Description,
+		rec.ArticleURL,
+		rec.VideoURL,
+		rec.Zipcode,
+		rec.Latitude,
+		rec.Longitude,
+		causeID,
+		useOfForceID,
+		raceID,
+		countyID,
+		agencyID,
+		cityID,
+		stateID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = l.unlink.Exec(rec.ID)
+	if err != nil {
+		return err
+	}
+	for _, id := range agencyIDs {
+		_, err = l.link.Exec(rec.ID, id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// agencyStateID is the state of an agency named by an incident in the given
+// state, assuming only federal agencies work across states
+func agencyStateID(name string, stateID int) *int {
+	agencyType := inferAgencyType(name)
+	if agencyType != nil && *agencyType == "federal" {
+		return nil
+	}
+	return &stateID
+}
+
+func (l *loader) Close() error {
+	for _, lookup := range []*lookup{
+		l.state,
+		l.city,
+		l.county,
+		l.agency,
+		l.cause,
+		l.race,
+		l.useOfForce,
+	} {
+		if lookup != nil {
+			lookup.Close()
+		}
+	}
+	for _, stmt := range []*sql.Stmt{l.unlink, l.link} {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+	if l.incident != nil {
+		return l.incident.Close()
+	}
+	return nil
+}
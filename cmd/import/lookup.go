@@ -0,0 +1,102 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"reflect"
+)
+
+// lookup resolves enumeration names to ids, inserting rows as needed
+type lookup struct {
+	stmt *sql.Stmt
+	ids  map[string]int
+}
+
+const (
+	sqlUpsertEnum = `
+		INSERT INTO %s (name)
+		VALUES ($1)
+		ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id
+	`
+	sqlUpsertStateEnum = `
+		INSERT INTO %s (name, state_id)
+		VALUES ($1, $2)
+		ON CONFLICT (name, state_id) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id
+	`
+	sqlUpsertState = `
+		INSERT INTO state (shortname, name)
+		VALUES ($1, $2)
+		ON CONFLICT (shortname) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id
+	`
+)
+
+func newLookup(tx *sql.Tx, text string) (*lookup, error) {
+	stmt, err := tx.Prepare(text)
+	if err != nil {
+		return nil, err
+	}
+	return &lookup{stmt, map[string]int{}}, nil
+}
+
+func newEnumLookup(tx *sql.Tx, table string) (*lookup, error) {
+	return newLookup(tx, fmt.Sprintf(sqlUpsertEnum, table))
+}
+
+func newStateEnumLookup(tx *sql.Tx, table string) (*lookup, error) {
+	return newLookup(tx, fmt.Sprintf(sqlUpsertStateEnum, table))
+}
+
+func newStateLookup(tx *sql.Tx) (*lookup, error) {
+	return newLookup(tx, sqlUpsertState)
+}
+
+// id gets the row id for the given key columns
+func (l *lookup) id(args ...interface{}) (int, error) {
+	key := lookupKey(args)
+	if id, ok := l.ids[key]; ok {
+		return id, nil
+	}
+	var id int
+	err := l.stmt.QueryRow(args...).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	l.ids[key] = id
+	return id, nil
+}
+
+// lookupKey formats args by value, since nullable columns are
+// given as pointers whose addresses change from row to row
+func lookupKey(args []interface{}) string {
+	values := make([]interface{}, len(args))
+	for i, arg := range args {
+		values[i] = arg
+		if v := reflect.ValueOf(arg); v.Kind() == reflect.Ptr {
+			values[i] = nil
+			if !v.IsNil() {
+				values[i] = v.Elem().Interface()
+			}
+		}
+	}
+	return fmt.Sprintf("%#v", values)
+}
+
+// maybeID is id for nullable names
+func (l *lookup) maybeID(name *string, args ...interface{}) (*int, error) {
+	if name == nil {
+		return nil, nil
+	}
+	args = append([]interface{}{*name}, args...)
+	id, err := l.id(args...)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+func (l *lookup) Close() error {
+	return l.stmt.Close()
+}
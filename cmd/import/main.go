@@ -0,0 +1,162 @@
+// Command import loads the Fatal Encounters spreadsheet, exported as CSV,
+// into the database queried by the server.
+//
+// Usage:
+//
+//	import -file fatal_encounters.csv
+//	import -population population.csv
+//	import -agencies agencies.csv
+//
+// Population estimates are matched to the races of the incidents,
+// so load them after the incidents. Agency types are guessed from their
+// names when loading incidents; an agencies CSV fills in or corrects them.
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/tim-harding/fatal-encounters-server/config"
+	"github.com/tim-harding/fatal-encounters-server/migrate"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+const (
+	// sqlRefreshSearch rebuilds incident.search_vector from the loaded rows
+	sqlRefreshSearch = "SELECT refresh_incident_search()"
+	// sqlRefreshCounts recomputes the count views
+	sqlRefreshCounts = "SELECT refresh_counts()"
+	// sqlBumpVersion marks the data as changed, expiring cached responses
+	sqlBumpVersion = "UPDATE dataset_version SET version = version + 1, updated_at = now()"
+)
+
+func main() {
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	file := fs.String("file", "", "path to the Fatal Encounters CSV export")
+	population := fs.String("population", "", "path to a CSV of population estimates with columns "+strings.Join(populationHeader, ","))
+	agencies := fs.String("agencies", "", "path to a CSV of agency details with columns "+strings.Join(agencyHeader, ","))
+	cfg, err := config.LoadDatabase(fs, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *file == "" && *population == "" && *agencies == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	db, err := shared.Connect(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	err = migrate.Up(db)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *file != "" {
+		count, err := importFile(db, *file, importCSV)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Imported %d incidents", count)
+	}
+	if *population != "" {
+		count, err := importFile(db, *population, importPopulation)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Imported %d population estimates", count)
+	}
+	if *agencies != "" {
+		count, err := importFile(db, *agencies, importAgencies)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("Imported %d agencies", count)
+	}
+}
+
+func importFile(db *sql.DB, path string, load func(db *sql.DB, r io.Reader) (int, error)) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return load(db, f)
+}
+
+func importCSV(db *sql.DB, r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return 0, err
+	}
+	cols, err := mapColumns(header)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	l, err := newLoader(tx)
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+
+	count := 0
+	for line := 2; ; line++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		rec, err := cols.parse(values)
+		if err != nil {
+			// The spreadsheet ends with notes and blank rows
+			log.Printf("Skipping line %d: %v", line, err)
+			continue
+		}
+		err = l.load(rec)
+		if err != nil {
+			return 0, err
+		}
+		count++
+	}
+
+	_, err = tx.Exec(sqlRefreshSearch)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(sqlRefreshCounts)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(sqlBumpVersion)
+	if err != nil {
+		return 0, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
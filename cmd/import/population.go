@@ -0,0 +1,145 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// populationHeader is the expected header of a population CSV.
+// Empty state, county and race fields stand for all of them.
+var populationHeader = []string{"year", "state", "county", "race", "population"}
+
+const (
+	sqlUpsertPopulation = `
+		INSERT INTO population (year, state_id, county_id, race_id, population)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (year, COALESCE(state_id, 0), COALESCE(county_id, 0), COALESCE(race_id, 0))
+		DO UPDATE SET population = EXCLUDED.population
+	`
+	// Races come from the incidents, so population rows must use their names
+	sqlSelectRace = `SELECT id FROM race WHERE name = $1`
+)
+
+// populationRecord is one row of a population CSV
+type populationRecord struct {
+	Year       int
+	State      string
+	County     *string
+	Race       *string
+	Population int
+}
+
+func parsePopulation(values []string) (populationRecord, error) {
+	rec := populationRecord{}
+	if len(values) != len(populationHeader) {
+		return rec, fmt.Errorf("expected %d fields, got %d", len(populationHeader), len(values))
+	}
+	var err error
+	rec.Year, err = strconv.Atoi(strings.TrimSpace(values[0]))
+	if err != nil {
+		return rec, fmt.Errorf("year: %w", err)
+	}
+	rec.State = strings.ToUpper(strings.TrimSpace(values[1]))
+	if _, ok := stateNames[rec.State]; rec.State != "" && !ok {
+		return rec, fmt.Errorf("unknown state %q", rec.State)
+	}
+	rec.County = parseText(strings.TrimSpace(values[2]))
+	if rec.County != nil && rec.State == "" {
+		return rec, fmt.Errorf("county %q needs a state", *rec.County)
+	}
+	rec.Race = parseText(strings.TrimSpace(values[3]))
+	rec.Population, err = strconv.Atoi(strings.TrimSpace(values[4]))
+	if err != nil {
+		return rec, fmt.Errorf("population: %w", err)
+	}
+	return rec, nil
+}
+
+// importPopulation loads Census population estimates, replacing any
+// already loaded for the same year, place and race
+func importPopulation(db *sql.DB, r io.Reader) (int, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return 0, err
+	}
+	if strings.Join(header, ",") != strings.Join(populationHeader, ",") {
+		return 0, fmt.Errorf("expected header %s", strings.Join(populationHeader, ","))
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	upsert, err := tx.Prepare(sqlUpsertPopulation)
+	if err != nil {
+		return 0, err
+	}
+	defer upsert.Close()
+	state, err := newStateLookup(tx)
+	if err != nil {
+		return 0, err
+	}
+	defer state.Close()
+	county, err := newStateEnumLookup(tx, "county")
+	if err != nil {
+		return 0, err
+	}
+	defer county.Close()
+	race, err := newLookup(tx, sqlSelectRace)
+	if err != nil {
+		return 0, err
+	}
+	defer race.Close()
+
+	count := 0
+	for line := 2; ; line++ {
+		values, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		rec, err := parsePopulation(values)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		var stateID, countyID, raceID *int
+		if rec.State != "" {
+			id, err := state.id(rec.State, stateNames[rec.State])
+			if err != nil {
+				return 0, err
+			}
+			stateID = &id
+			countyID, err = county.maybeID(rec.County, id)
+			if err != nil {
+				return 0, err
+			}
+		}
+		raceID, err = race.maybeID(rec.Race)
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("line %d: no incidents have race %q", line, *rec.Race)
+		}
+		if err != nil {
+			return 0, err
+		}
+		_, err = upsert.Exec(rec.Year, stateID, countyID, raceID, rec.Population)
+		if err != nil {
+			return 0, fmt.Errorf("line %d: %w", line, err)
+		}
+		count++
+	}
+
+	_, err = tx.Exec(sqlBumpVersion)
+	if err != nil {
+		return 0, err
+	}
+	return count, tx.Commit()
+}
@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestParsesPopulation(t *testing.T) {
+	rec, err := parsePopulation([]string{"2019", "or", "Multnomah", "", "812855"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Year != 2019 || rec.State != "OR" || *rec.County != "Multnomah" || rec.Race != nil || rec.Population != 812855 {
+		t.Errorf("Unexpected record %+v", rec)
+	}
+}
+
+func TestRejectsCountyWithoutState(t *testing.T) {
+	_, err := parsePopulation([]string{"2019", "", "Multnomah", "", "812855"})
+	if err == nil {
+		t.Error("Expected an error for a county without a state")
+	}
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type field int
+
+const (
+	fieldID field = iota
+	fieldName
+	fieldAge
+	fieldGender
+	fieldRace
+	fieldImageURL
+	fieldDate
+	fieldAddress
+	fieldCity
+	fieldState
+	fieldZipcode
+	fieldCounty
+	fieldLatitude
+	fieldLongitude
+	fieldAgency
+	fieldCause
+	fieldUseOfForce
+	fieldDescription
+	fieldArticleURL
+	fieldVideoURL
+	fieldCount
+)
+
+// Header prefixes for each field, in order of preference.
+// The spreadsheet has renamed several columns between releases.
+var fieldHeaders = [fieldCount][]string{
+	fieldID:          {"unique id"},
+	fieldName:        {"subject's name", "name"},
+	fieldAge:         {"subject's age", "age"},
+	fieldGender:      {"subject's gender", "gender"},
+	fieldRace:        {"subject's race", "race"},
+	fieldImageURL:    {"url of image"},
+	fieldDate:        {"date of injury resulting in death"},
+	fieldAddress:     {"location of injury"},
+	fieldCity:        {"location of death (city)"},
+	fieldState:       {"state"},
+	fieldZipcode:     {"location of death (zip code)"},
+	fieldCounty:      {"location of death (county)"},
+	fieldLatitude:    {"latitude"},
+	fieldLongitude:   {"longitude"},
+	fieldAgency:      {"agency or agencies involved", "agency responsible for death"},
+	fieldCause:       {"highest level of force", "cause of death"},
+	fieldUseOfForce:  {"intended use of force"},
+	fieldDescription: {"brief description", "a brief description"},
+	fieldArticleURL:  {"supporting document link", "link to news article"},
+	fieldVideoURL:    {"video"},
+}
+
+var requiredFields = []field{
+	fieldID,
+	fieldDate,
+	fieldState,
+}
+
+const (
+	unknownCause      = "Undetermined"
+	unknownUseOfForce = "Undetermined"
+)
+
+// columns maps each field to its index in a CSV record, or -1 if absent
+type columns [fieldCount]int
+
+type record struct {
+	ID        int
+	Name      *string
+	Age       *int
+	IsMale    *bool
+	Race      *string
+	ImageURL  *string
+	Date      time.Time
+	Address   *string
+	City      *string
+	State     string
+	Zipcode   *int
+	County    *string
+	Latitude  *float64
+	Longitude *float64
+	// Agencies are every agency involved, the first being the lead
+	Agencies    []string
+	Cause       string
+	UseOfForce  string
+	Description string
+	ArticleURL  *string
+	VideoURL    *string
+}
+
+func mapColumns(header []string) (columns, error) {
+	var c columns
+	for f := range c {
+		c[f] = -1
+	}
+	for f, prefixes := range fieldHeaders {
+	prefixes:
+		for _, prefix := range prefixes {
+			for i, name := range header {
+				name = strings.ToLower(strings.TrimSpace(name))
+				if name == prefix || strings.HasPrefix(name, prefix+" ") {
+					c[f] = i
+					break prefixes
+				}
+			}
+		}
+	}
+	for _, f := range requiredFields {
+		if c[f] < 0 {
+			return c, fmt.Errorf("missing column for %q", fieldHeaders[f][0])
+		}
+	}
+	return c, nil
+}
+
+func (c *columns) get(values []string, f field) string {
+	i := c[f]
+	if i < 0 || i >= len(values) {
+		return ""
+	}
+	return strings.TrimSpace(values[i])
+}
+
+func (c *columns) parse(values []string) (record, error) {
+	rec := record{}
+
+	id, err := strconv.Atoi(c.get(values, fieldID))
+	if err != nil {
+		return rec, fmt.Errorf("invalid unique ID: %w", err)
+	}
+	rec.ID = id
+
+	date, err := parseDate(c.get(values, fieldDate))
+	if err != nil {
+		return rec, err
+	}
+	rec.Date = date
+
+	rec.State = strings.ToUpper(c.get(values, fieldState))
+	if _, ok := stateNames[rec.State]; !ok {
+		return rec, fmt.Errorf("unknown state %q", rec.State)
+	}
+
+	rec.Name = parseText(c.get(values, fieldName))
+	rec.Age = parseAge(c.get(values, fieldAge))
+	rec.IsMale = parseGender(c.get(values, fieldGender))
+	rec.Race = parseRace(c.get(values, fieldRace))
+	rec.ImageURL = parseText(c.get(values, fieldImageURL))
+	rec.Address = parseText(c.get(values, fieldAddress))
+	rec.City = parseText(c.get(values, fieldCity))
+	rec.Zipcode = parseInt(c.get(values, fieldZipcode))
+	rec.County = parseText(c.get(values, fieldCounty))
+	rec.Latitude = parseFloat(c.get(values, fieldLatitude))
+	rec.Longitude = parseFloat(c.get(values, fieldLongitude))
+	rec.Agencies = parseAgencies(c.get(values, fieldAgency))
+	rec.Cause = parseEnum(c.get(values, fieldCause), unknownCause)
+	rec.UseOfForce = parseEnum(c.get(values, fieldUseOfForce), unknownUseOfForce)
+	rec.Description = c.get(values, fieldDescription)
+	rec.ArticleURL = parseText(c.get(values, fieldArticleURL))
+	rec.VideoURL = parseText(c.get(values, fieldVideoURL))
+
+	return rec, nil
+}
+
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range []string{"1/2/2006", "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q", s)
+}
+
+func parseText(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func parseEnum(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+func parseInt(s string) *int {
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return nil
+	}
+	return &i
+}
+
+func parseFloat(s string) *float64 {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil
+	}
+	return &f
+}
+
+// Ages are mostly whole years, but infants are listed as e.g. "18 months"
+// and some entries are approximate, e.g. "20s".
+func parseAge(s string) *int {
+	if age := parseInt(s); age != nil {
+		return age
+	}
+	lower := strings.ToLower(s)
+	if strings.Contains(lower, "month") || strings.Contains(lower, "day") {
+		age := 0
+		return &age
+	}
+	digits := strings.TrimRight(lower, "s")
+	return parseInt(digits)
+}
+
+func parseGender(s string) *bool {
+	isMale, ok := map[string]bool{
+		"male":   true,
+		"female": false,
+	}[strings.ToLower(s)]
+	if !ok {
+		return nil
+	}
+	return &isMale
+}
+
+func parseRace(s string) *string {
+	if strings.EqualFold(s, "race unspecified") {
+		return nil
+	}
+	return parseText(s)
+}
+
+// parseAgencies splits the comma-separated agencies of an incident
+func parseAgencies(s string) []string {
+	agencies := []string{}
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name != "" {
+			agencies = append(agencies, name)
+		}
+	}
+	return agencies
+}
@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+var header = []string{
+	"Unique ID",
+	"Subject's name",
+	"Subject's age",
+	"Subject's gender",
+	"Subject's race",
+	"Date of injury resulting in death (month/day/year)",
+	"Location of death (city)",
+	"State",
+	"Location of death (zip code)",
+	"Latitude",
+	"Longitude",
+	"Agency responsible for death",
+	"Cause of death",
+	"A brief description of the circumstances surrounding the death",
+}
+
+func TestMapsColumns(t *testing.T) {
+	c, err := mapColumns(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c[fieldCity] != 6 || c[fieldState] != 7 || c[fieldCause] != 12 {
+		t.Errorf("Unexpected columns %v", c)
+	}
+	if c[fieldVideoURL] != -1 {
+		t.Errorf("Was %d;\nWant -1", c[fieldVideoURL])
+	}
+}
+
+func TestRejectsMissingRequiredColumn(t *testing.T) {
+	_, err := mapColumns(header[1:])
+	if err == nil {
+		t.Error("Expected an error for a missing Unique ID column")
+	}
+}
+
+func TestParsesRecord(t *testing.T) {
+	c, _ := mapColumns(header)
+	rec, err := c.parse([]string{
+		"42", "Jane Doe", "18 months", "Female", "Race unspecified",
+		"01/02/2003", "Springfield", "il", "62701", "39.8", "-89.6",
+		"Springfield Police Department", "", "Description",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.ID != 42 || rec.State != "IL" || rec.Date.Year() != 2003 {
+		t.Errorf("Unexpected record %+v", rec)
+	}
+	if rec.Age == nil || *rec.Age != 0 {
+		t.Errorf("Was %v;\nWant 0", rec.Age)
+	}
+	if rec.IsMale == nil || *rec.IsMale {
+		t.Errorf("Was %v;\nWant false", rec.IsMale)
+	}
+	if rec.Race != nil {
+		t.Errorf("Was %v;\nWant nil", *rec.Race)
+	}
+	if rec.Cause != unknownCause {
+		t.Errorf("Was `%s`;\nWant `%s`", rec.Cause, unknownCause)
+	}
+}
+
+func TestSkipsRecordWithoutDate(t *testing.T) {
+	c, _ := mapColumns(header)
+	_, err := c.parse([]string{"42", "Jane Doe", "", "", "", "", "", "IL"})
+	if err == nil {
+		t.Error("Expected an error for a missing date")
+	}
+}
+
+func TestParsesApproximateAge(t *testing.T) {
+	age := parseAge("20s")
+	if age == nil || *age != 20 {
+		t.Errorf("Was %v;\nWant 20", age)
+	}
+}
+
+func TestParsesAgencies(t *testing.T) {
+	agencies := parseAgencies("Portland Police Bureau, Multnomah County Sheriff's Office,,")
+	if len(agencies) != 2 || agencies[0] != "Portland Police Bureau" || agencies[1] != "Multnomah County Sheriff's Office" {
+		t.Errorf("Unexpected agencies %q", agencies)
+	}
+}
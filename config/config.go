@@ -0,0 +1,351 @@
+// Package config loads server settings from defaults, a JSON config file,
+// environment variables and command line flags, in increasing precedence.
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config holds the settings shared by the server and tools
+type Config struct {
+	// DSN is the lib/pq database connection string
+	DSN string `json:"dsn"`
+	// Addr is the address the HTTP server listens on
+	Addr string `json:"addr"`
+	// MaxOpenConns limits open database connections, zero for unlimited
+	MaxOpenConns int `json:"maxOpenConns"`
+	// MaxIdleConns limits idle database connections
+	MaxIdleConns int `json:"maxIdleConns"`
+	// ConnMaxLifetime closes database connections older than this, zero to keep forever
+	ConnMaxLifetime Duration `json:"connMaxLifetime"`
+	// ConnectAttempts is how many times to try reaching the database at startup
+	ConnectAttempts int `json:"connectAttempts"`
+	// ConnectBackoff is the delay after the first failed attempt, doubled after each one
+	ConnectBackoff Duration `json:"connectBackoff"`
+	// QueryTimeout cancels a request's database work after this long
+	QueryTimeout Duration `json:"queryTimeout"`
+	// RouteTimeouts overrides QueryTimeout for the given route patterns
+	RouteTimeouts map[string]Duration `json:"routeTimeouts"`
+	// ShutdownTimeout is how long to wait for in-flight requests on shutdown
+	ShutdownTimeout Duration `json:"shutdownTimeout"`
+	// StrictParams rejects requests with invalid query parameters
+	// instead of ignoring the parameters
+	StrictParams bool `json:"strictParams"`
+	// CacheSize bounds the bytes of cached response bodies, zero to disable caching
+	CacheSize int `json:"cacheSize"`
+	// CacheEntrySize bounds the body of a single cached response
+	CacheEntrySize int `json:"cacheEntrySize"`
+	// CacheTTL is how long a cached response is served
+	CacheTTL Duration `json:"cacheTTL"`
+}
+
+// Timeout gets the query timeout for a route pattern
+func (c *Config) Timeout(route string) time.Duration {
+	if timeout, ok := c.RouteTimeouts[route]; ok {
+		return timeout.Duration
+	}
+	return c.QueryTimeout.Duration
+}
+
+// Duration is a time.Duration that reads from strings like "30s"
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalJSON parses a duration string
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	err := json.Unmarshal(b, &s)
+	if err != nil {
+		return err
+	}
+	return d.Set(s)
+}
+
+// MarshalJSON formats the duration as a string
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// Set parses a duration string, implementing flag.Value
+func (d *Duration) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+	return nil
+}
+
+const envConfigFile = "FE_CONFIG"
+
+// Default returns the settings used when nothing else is given
+func Default() Config {
+	return Config{
+		DSN:             "host=localhost port=5432 user=postgres password=postgres dbname=fatal_encounters sslmode=disable",
+		Addr:            ":3000",
+		MaxOpenConns:    0,
+		MaxIdleConns:    2,
+		ConnMaxLifetime: Duration{0},
+		ConnectAttempts: 10,
+		ConnectBackoff:  Duration{500 * time.Millisecond},
+		QueryTimeout:    Duration{10 * time.Second},
+		RouteTimeouts: map[string]Duration{
+			"/incident/count": {30 * time.Second},
+			// Exports stream the whole table
+			"/incident/export": {5 * time.Minute},
+		},
+		ShutdownTimeout: Duration{15 * time.Second},
+		CacheSize:       64 << 20,
+		CacheEntrySize:  1 << 20,
+		CacheTTL:        Duration{10 * time.Minute},
+	}
+}
+
+// Load registers the config flags on fs, parses args and
+// combines every settings source
+func Load(fs *flag.FlagSet, args []string) (Config, error) {
+	return loadSettings(fs, args, append(databaseSettings, serverSettings...))
+}
+
+// LoadDatabase is Load with only the database settings, for tools
+// that connect to the database without serving anything. The rest
+// of a config file is ignored.
+func LoadDatabase(fs *flag.FlagSet, args []string) (Config, error) {
+	return loadSettings(fs, args, databaseSettings)
+}
+
+func loadSettings(fs *flag.FlagSet, args []string, settings []setting) (Config, error) {
+	cfg := Default()
+	file := fs.String("config", os.Getenv(envConfigFile), "path to a JSON config file")
+	values := registerFlags(fs, &cfg, settings)
+	err := fs.Parse(args)
+	if err != nil {
+		return cfg, err
+	}
+
+	if *file != "" {
+		err := loadFile(*file, &cfg)
+		if err != nil {
+			return cfg, err
+		}
+	}
+
+	err = loadEnv(&cfg, settings)
+	if err != nil {
+		return cfg, err
+	}
+
+	fs.Visit(func(f *flag.Flag) {
+		if apply, ok := values[f.Name]; ok && err == nil {
+			err = apply()
+		}
+	})
+	return cfg, err
+}
+
+func loadFile(path string, cfg *Config) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	decoder := json.NewDecoder(f)
+	decoder.DisallowUnknownFields()
+	err = decoder.Decode(cfg)
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// setting binds one Config field to its environment variable and flag
+type setting struct {
+	env   string
+	flag  string
+	usage string
+	set   func(cfg *Config, value string) error
+}
+
+// databaseSettings are the ones the importer needs to connect
+var databaseSettings = []setting{
+	{
+		"FE_DSN",
+		"dsn",
+		"database connection string",
+		func(cfg *Config, value string) error {
+			cfg.DSN = value
+			return nil
+		},
+	},
+	{
+		"FE_MAX_OPEN_CONNS",
+		"max-open-conns",
+		"maximum open database connections, 0 for unlimited",
+		intSetter(func(cfg *Config) *int { return &cfg.MaxOpenConns }),
+	},
+	{
+		"FE_MAX_IDLE_CONNS",
+		"max-idle-conns",
+		"maximum idle database connections",
+		intSetter(func(cfg *Config) *int { return &cfg.MaxIdleConns }),
+	},
+	{
+		"FE_CONN_MAX_LIFETIME",
+		"conn-max-lifetime",
+		"maximum database connection age, e.g. 5m",
+		durationSetter(func(cfg *Config) *Duration { return &cfg.ConnMaxLifetime }),
+	},
+	{
+		"FE_CONNECT_ATTEMPTS",
+		"connect-attempts",
+		"times to try connecting to the database at startup",
+		intSetter(func(cfg *Config) *int { return &cfg.ConnectAttempts }),
+	},
+	{
+		"FE_CONNECT_BACKOFF",
+		"connect-backoff",
+		"delay after the first failed connection attempt, e.g. 500ms",
+		durationSetter(func(cfg *Config) *Duration { return &cfg.ConnectBackoff }),
+	},
+}
+
+// serverSettings are the rest, used only by the server
+var serverSettings = []setting{
+	{
+		"FE_ADDR",
+		"addr",
+		"HTTP listen address",
+		func(cfg *Config, value string) error {
+			cfg.Addr = value
+			return nil
+		},
+	},
+	{
+		"FE_QUERY_TIMEOUT",
+		"query-timeout",
+		"time limit on a request's database work, e.g. 10s",
+		durationSetter(func(cfg *Config) *Duration { return &cfg.QueryTimeout }),
+	},
+	{
+		"FE_ROUTE_TIMEOUTS",
+		"route-timeouts",
+		"per-route query timeouts, e.g. /incident/count=30s,/incident/position=20s",
+		setRouteTimeouts,
+	},
+	{
+		"FE_SHUTDOWN_TIMEOUT",
+		"shutdown-timeout",
+		"time to wait for in-flight requests on shutdown, e.g. 15s",
+		durationSetter(func(cfg *Config) *Duration { return &cfg.ShutdownTimeout }),
+	},
+	{
+		"FE_STRICT_PARAMS",
+		"strict-params",
+		"reject requests with invalid query parameters, true or false",
+		func(cfg *Config, value string) error {
+			strict, err := strconv.ParseBool(value)
+			if err != nil {
+				return err
+			}
+			cfg.StrictParams = strict
+			return nil
+		},
+	},
+	{
+		"FE_CACHE_SIZE",
+		"cache-size",
+		"bytes of cached responses, 0 to disable caching",
+		intSetter(func(cfg *Config) *int { return &cfg.CacheSize }),
+	},
+	{
+		"FE_CACHE_ENTRY_SIZE",
+		"cache-entry-size",
+		"bytes of the largest cached response",
+		intSetter(func(cfg *Config) *int { return &cfg.CacheEntrySize }),
+	},
+	{
+		"FE_CACHE_TTL",
+		"cache-ttl",
+		"time a cached response is served, e.g. 10m",
+		durationSetter(func(cfg *Config) *Duration { return &cfg.CacheTTL }),
+	},
+}
+
+func intSetter(field func(cfg *Config) *int) func(cfg *Config, value string) error {
+	return func(cfg *Config, value string) error {
+		i, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		*field(cfg) = i
+		return nil
+	}
+}
+
+func durationSetter(field func(cfg *Config) *Duration) func(cfg *Config, value string) error {
+	return func(cfg *Config, value string) error {
+		return field(cfg).Set(value)
+	}
+}
+
+// setRouteTimeouts parses route=duration pairs, adding to the existing overrides
+func setRouteTimeouts(cfg *Config, value string) error {
+	timeouts := map[string]Duration{}
+	for route, timeout := range cfg.RouteTimeouts {
+		timeouts[route] = timeout
+	}
+	for _, pair := range strings.Split(value, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("expected route=duration, got %q", pair)
+		}
+		timeout := Duration{}
+		err := timeout.Set(parts[1])
+		if err != nil {
+			return err
+		}
+		timeouts[strings.TrimSpace(parts[0])] = timeout
+	}
+	cfg.RouteTimeouts = timeouts
+	return nil
+}
+
+func loadEnv(cfg *Config, settings []setting) error {
+	for _, s := range settings {
+		value, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		err := s.set(cfg, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", s.env, err)
+		}
+	}
+	return nil
+}
+
+// registerFlags adds a string flag per setting. Flags are applied
+// after the file and environment, so the returned functions set
+// the parsed values once those are loaded.
+func registerFlags(fs *flag.FlagSet, cfg *Config, settings []setting) map[string]func() error {
+	values := map[string]func() error{}
+	for _, s := range settings {
+		s := s
+		value := fs.String(s.flag, "", fmt.Sprintf("%s (env %s)", s.usage, s.env))
+		values[s.flag] = func() error {
+			err := s.set(cfg, *value)
+			if err != nil {
+				return fmt.Errorf("-%s: %w", s.flag, err)
+			}
+			return nil
+		}
+	}
+	return values
+}
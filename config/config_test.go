@@ -0,0 +1,102 @@
+package config
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func load(t *testing.T, args ...string) Config {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg, err := Load(fs, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+func TestDefaults(t *testing.T) {
+	cfg := load(t)
+	if cfg.Addr != ":3000" {
+		t.Errorf("Was `%s`;\nWant `:3000`", cfg.Addr)
+	}
+}
+
+func TestEnvironmentOverridesDefaults(t *testing.T) {
+	os.Setenv("FE_MAX_OPEN_CONNS", "7")
+	defer os.Unsetenv("FE_MAX_OPEN_CONNS")
+	cfg := load(t)
+	if cfg.MaxOpenConns != 7 {
+		t.Errorf("Was %d;\nWant 7", cfg.MaxOpenConns)
+	}
+}
+
+func TestFlagsOverrideEnvironment(t *testing.T) {
+	os.Setenv("FE_ADDR", ":4000")
+	defer os.Unsetenv("FE_ADDR")
+	cfg := load(t, "-addr", ":5000")
+	if cfg.Addr != ":5000" {
+		t.Errorf("Was `%s`;\nWant `:5000`", cfg.Addr)
+	}
+}
+
+func TestReadsConfigFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "config*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"dsn": "dbname=test", "connMaxLifetime": "5m"}`)
+	f.Close()
+
+	cfg := load(t, "-config", f.Name())
+	if cfg.DSN != "dbname=test" {
+		t.Errorf("Was `%s`;\nWant `dbname=test`", cfg.DSN)
+	}
+	if cfg.ConnMaxLifetime.Duration != 5*time.Minute {
+		t.Errorf("Was %v;\nWant 5m", cfg.ConnMaxLifetime)
+	}
+}
+
+func TestRejectsInvalidValues(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	_, err := Load(fs, []string{"-connect-backoff", "soon"})
+	if err == nil {
+		t.Error("Expected an error for an invalid duration")
+	}
+}
+
+func TestRouteTimeouts(t *testing.T) {
+	cfg := load(t, "-query-timeout", "2s", "-route-timeouts", "/incident/position=20s")
+	if cfg.Timeout("/incident/position") != 20*time.Second {
+		t.Errorf("Was %v;\nWant 20s", cfg.Timeout("/incident/position"))
+	}
+	if cfg.Timeout("/incident/count") != 30*time.Second {
+		t.Errorf("Was %v;\nWant 30s", cfg.Timeout("/incident/count"))
+	}
+	if cfg.Timeout("/city") != 2*time.Second {
+		t.Errorf("Was %v;\nWant 2s", cfg.Timeout("/city"))
+	}
+}
+
+func TestLoadDatabaseSkipsServerSettings(t *testing.T) {
+	os.Setenv("FE_CACHE_SIZE", "invalid")
+	defer os.Unsetenv("FE_CACHE_SIZE")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	cfg, err := LoadDatabase(fs, []string{"-dsn", "dbname=test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.DSN != "dbname=test" {
+		t.Errorf("Was `%s`;\nWant `dbname=test`", cfg.DSN)
+	}
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(ioutil.Discard)
+	_, err = LoadDatabase(fs, []string{"-addr", ":5000"})
+	if err == nil {
+		t.Error("Expected an error for a server flag")
+	}
+}
@@ -3,6 +3,7 @@ module github.com/tim-harding/fatal-encounters-server
 go 1.14
 
 require (
+	github.com/DATA-DOG/go-sqlmock v1.5.0
 	github.com/go-chi/chi v4.1.2+incompatible
 	github.com/lib/pq v1.8.0
 	golang.org/x/net v0.0.0-20200904194848-62affa334b73 // indirect
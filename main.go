@@ -1,54 +1,75 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
-	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
-	"github.com/tim-harding/fatal-encounters-server/routes/cityroute"
-	"github.com/tim-harding/fatal-encounters-server/routes/enumroute"
-	"github.com/tim-harding/fatal-encounters-server/routes/incidentroute"
-	"github.com/tim-harding/fatal-encounters-server/routes/stateroute"
+	"github.com/tim-harding/fatal-encounters-server/config"
+	"github.com/tim-harding/fatal-encounters-server/migrate"
 	"github.com/tim-harding/fatal-encounters-server/shared"
 )
 
-var enumTables = []string{
-	"agency",
-	"cause",
-	"county",
-	"race",
-	"use_of_force",
-}
-
 func main() {
-	defer shared.Db.Close()
-	r := chi.NewRouter()
-	r.Use(middleware.Logger)
-	r.Route("/city", func(r chi.Router) {
-		r.Get("/", cityroute.HandleBaseRoute)
-		r.Get("/{id}", cityroute.HandleIDRoute)
-	})
-	r.Route("/state", func(r chi.Router) {
-		r.Get("/", stateroute.HandleBaseRoute)
-		r.Get("/{id}", stateroute.HandleIDRoute)
-	})
-	for _, table := range enumTables {
-		route := fmt.Sprintf("/%s", table)
-		r.Route(route, func(r chi.Router) {
-			r.Get("/", enumroute.HandleBaseRouteFactory(table))
-			r.Get("/{id}", enumroute.HandleIDRouteFactory(table))
-		})
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	cfg, err := config.Load(fs, os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := shared.Connect(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	args := fs.Args()
+	if len(args) > 0 && args[0] == "migrate" {
+		err := migrate.Command(db, args[1:], os.Stdout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-	r.Route("/incident", func(r chi.Router) {
-		r.Get("/filter", incidentroute.HandleIncidentFilterRoute)
-		r.Get("/position", incidentroute.HandleIncidentPositionRoute)
-		r.Get("/detail/{id:[0-9,]+}", incidentroute.HandleIncidentDetailRoute)
-		r.Get("/count", incidentroute.HandleCountRoute)
-	})
-	err := http.ListenAndServe(":3000", r)
+
+	s := shared.NewServer(db, cfg)
+	err = serve(cfg, newRouter(s))
 	if err != nil {
 		log.Fatal(err)
 	}
 }
+
+// serve listens until the process receives SIGINT or SIGTERM,
+// then waits for in-flight requests to finish
+func serve(cfg config.Config, handler http.Handler) error {
+	srv := &http.Server{
+		Addr:    cfg.Addr,
+		Handler: handler,
+	}
+
+	failed := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %s", cfg.Addr)
+		err := srv.ListenAndServe()
+		if err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case err := <-failed:
+		return err
+	case sig := <-signals:
+		log.Printf("Received %v, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout.Duration)
+	defer cancel()
+	return srv.Shutdown(ctx)
+}
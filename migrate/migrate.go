@@ -0,0 +1,177 @@
+// Package migrate owns the database schema. Migrations are compiled into
+// the binary and tracked in the schema_migrations table.
+package migrate
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"time"
+)
+
+// Migration is one versioned schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// State describes whether a migration has been applied
+type State struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+const (
+	sqlCreateMigrations = `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`
+	sqlSelectMigrations = "SELECT version, applied_at FROM schema_migrations"
+	sqlInsertMigration  = "INSERT INTO schema_migrations (version) VALUES ($1)"
+	sqlDeleteMigration  = "DELETE FROM schema_migrations WHERE version = $1"
+)
+
+// Up applies every pending migration
+func Up(db *sql.DB) error {
+	states, err := Status(db)
+	if err != nil {
+		return err
+	}
+	for _, state := range states {
+		if state.AppliedAt != nil {
+			continue
+		}
+		log.Printf("Applying migration %d: %s", state.Version, state.Name)
+		err := apply(db, state.Up, sqlInsertMigration, state.Version)
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", state.Version, err)
+		}
+	}
+	return nil
+}
+
+// Down reverts the given number of most recently applied migrations
+func Down(db *sql.DB, steps int) error {
+	states, err := Status(db)
+	if err != nil {
+		return err
+	}
+	for i := len(states) - 1; i >= 0 && steps > 0; i-- {
+		state := states[i]
+		if state.AppliedAt == nil {
+			continue
+		}
+		log.Printf("Reverting migration %d: %s", state.Version, state.Name)
+		err := apply(db, state.Down, sqlDeleteMigration, state.Version)
+		if err != nil {
+			return fmt.Errorf("migration %d: %w", state.Version, err)
+		}
+		steps--
+	}
+	return nil
+}
+
+// Status lists every known migration and when it was applied
+func Status(db *sql.DB) ([]State, error) {
+	_, err := db.Exec(sqlCreateMigrations)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedAt(db)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]State, 0, len(migrations))
+	for _, migration := range migrations {
+		state := State{migration, nil}
+		if t, ok := applied[migration.Version]; ok {
+			state.AppliedAt = &t
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Command runs `migrate up|down [steps]|status`, writing output to w
+func Command(db *sql.DB, args []string, w io.Writer) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: migrate up|down [steps]|status")
+	}
+	switch args[0] {
+	case "up":
+		return Up(db)
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid step count %q", args[1])
+			}
+			steps = n
+		}
+		return Down(db, steps)
+	case "status":
+		states, err := Status(db)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			applied := "pending"
+			if state.AppliedAt != nil {
+				applied = state.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%4d  %-25s  %s\n", state.Version, applied, state.Name)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+}
+
+func appliedAt(db *sql.DB) (map[int]time.Time, error) {
+	rows, err := db.Query(sqlSelectMigrations)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int]time.Time{}
+	for rows.Next() {
+		var (
+			version int
+			t       time.Time
+		)
+		err := rows.Scan(&version, &t)
+		if err != nil {
+			return nil, err
+		}
+		out[version] = t
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func apply(db *sql.DB, ddl, record string, version int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	_, err = tx.Exec(ddl)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(record, version)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
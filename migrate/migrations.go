@@ -0,0 +1,393 @@
+package migrate
+
+// Migrations are applied in order and never edited once released.
+// Add new schema changes by appending to this list.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "create lookup tables",
+		Up: `
+			CREATE TABLE state (
+				id SERIAL PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE,
+				shortname CHAR(2) NOT NULL UNIQUE
+			);
+
+			CREATE TABLE city (
+				id SERIAL PRIMARY KEY,
+				name TEXT NOT NULL,
+				state_id INTEGER NOT NULL REFERENCES state (id),
+				UNIQUE (name, state_id)
+			);
+
+			CREATE TABLE county (
+				id SERIAL PRIMARY KEY,
+				name TEXT NOT NULL,
+				state_id INTEGER NOT NULL REFERENCES state (id),
+				UNIQUE (name, state_id)
+			);
+
+			CREATE TABLE agency (
+				id SERIAL PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE
+			);
+
+			CREATE TABLE cause (
+				id SERIAL PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE
+			);
+
+			CREATE TABLE race (
+				id SERIAL PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE
+			);
+
+			CREATE TABLE use_of_force (
+				id SERIAL PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE
+			);
+		`,
+		Down: `
+			DROP TABLE use_of_force;
+			DROP TABLE race;
+			DROP TABLE cause;
+			DROP TABLE agency;
+			DROP TABLE county;
+			DROP TABLE city;
+			DROP TABLE state;
+		`,
+	},
+	{
+		Version: 2,
+		Name:    "create incident table",
+		Up: `
+			CREATE TABLE incident (
+				id INTEGER PRIMARY KEY,
+				name TEXT,
+				age INTEGER,
+				date DATE NOT NULL,
+				image_url TEXT,
+				is_male BOOLEAN,
+				address TEXT,
+				description TEXT NOT NULL,
+				article_url TEXT,
+				video_url TEXT,
+				zipcode INTEGER,
+				latitude DOUBLE PRECISION,
+				longitude DOUBLE PRECISION,
+				cause_id INTEGER NOT NULL REFERENCES cause (id),
+				use_of_force_id INTEGER NOT NULL REFERENCES use_of_force (id),
+				race_id INTEGER REFERENCES race (id),
+				county_id INTEGER REFERENCES county (id),
+				agency_id INTEGER REFERENCES agency (id),
+				city_id INTEGER REFERENCES city (id)
+			);
+		`,
+		Down: `
+			DROP TABLE incident;
+		`,
+	},
+	{
+		Version: 3,
+		Name:    "index filtered and joined columns",
+		Up: `
+			CREATE INDEX city_state_id_idx ON city (state_id);
+			CREATE INDEX county_state_id_idx ON county (state_id);
+
+			CREATE INDEX incident_cause_id_idx ON incident (cause_id);
+			CREATE INDEX incident_use_of_force_id_idx ON incident (use_of_force_id);
+			CREATE INDEX incident_race_id_idx ON incident (race_id);
+			CREATE INDEX incident_county_id_idx ON incident (county_id);
+			CREATE INDEX incident_agency_id_idx ON incident (agency_id);
+			CREATE INDEX incident_city_id_idx ON incident (city_id);
+
+			CREATE INDEX incident_date_idx ON incident (date);
+			CREATE INDEX incident_age_idx ON incident (age);
+			CREATE INDEX incident_name_idx ON incident (name);
+			CREATE INDEX incident_position_idx ON incident (latitude, longitude);
+		`,
+		Down: `
+			DROP INDEX incident_position_idx;
+			DROP INDEX incident_name_idx;
+			DROP INDEX incident_age_idx;
+			DROP INDEX incident_date_idx;
+
+			DROP INDEX incident_city_id_idx;
+			DROP INDEX incident_agency_id_idx;
+			DROP INDEX incident_county_id_idx;
+			DROP INDEX incident_race_id_idx;
+			DROP INDEX incident_use_of_force_id_idx;
+			DROP INDEX incident_cause_id_idx;
+
+			DROP INDEX county_state_id_idx;
+			DROP INDEX city_state_id_idx;
+		`,
+	},
+	{
+		Version: 4,
+		Name:    "add incident full text search",
+		Up: `
+			ALTER TABLE incident ADD COLUMN search_vector TSVECTOR;
+			CREATE INDEX incident_search_vector_idx ON incident USING GIN (search_vector);
+
+			-- Agency and city names live in other tables, so the vector
+			-- is refreshed after each import rather than generated
+			CREATE FUNCTION refresh_incident_search() RETURNS VOID AS $$
+				UPDATE incident SET search_vector =
+					setweight(to_tsvector('english', coalesce(incident.name, '')), 'A') ||
+					setweight(to_tsvector('english', incident.description), 'B') ||
+					setweight(to_tsvector('english', coalesce(agency.name, '')), 'C') ||
+					setweight(to_tsvector('english', coalesce(city.name, '')), 'C') ||
+					setweight(to_tsvector('english', coalesce(incident.address, '')), 'D')
+				FROM incident AS i
+				LEFT JOIN agency ON i.agency_id = agency.id
+				LEFT JOIN city ON i.city_id = city.id
+				WHERE incident.id = i.id
+			$$ LANGUAGE SQL;
+
+			SELECT refresh_incident_search();
+		`,
+		Down: `
+			DROP FUNCTION refresh_incident_search();
+			DROP INDEX incident_search_vector_idx;
+			ALTER TABLE incident DROP COLUMN search_vector;
+		`,
+	},
+	{
+		Version: 5,
+		Name:    "add earthdistance position index",
+		Up: `
+			CREATE EXTENSION IF NOT EXISTS cube;
+			CREATE EXTENSION IF NOT EXISTS earthdistance;
+			CREATE INDEX incident_earth_idx ON incident USING GIST (ll_to_earth(latitude, longitude));
+		`,
+		Down: `
+			-- The extensions may have been installed before this
+			-- migration, or be used elsewhere, so they are left in place
+			DROP INDEX incident_earth_idx;
+		`,
+	},
+	{
+		Version: 6,
+		Name:    "create population table",
+		Up: `
+			-- A NULL state, county or race covers all of them, so the
+			-- row with only a year is the national population
+			CREATE TABLE population (
+				id SERIAL PRIMARY KEY,
+				year INTEGER NOT NULL,
+				state_id INTEGER REFERENCES state (id),
+				county_id INTEGER REFERENCES county (id),
+				race_id INTEGER REFERENCES race (id),
+				population INTEGER NOT NULL CHECK (population > 0)
+			);
+			CREATE UNIQUE INDEX population_key_idx ON population (
+				year,
+				COALESCE(state_id, 0),
+				COALESCE(county_id, 0),
+				COALESCE(race_id, 0)
+			);
+
+			-- Gets the population from the year closest to the one given,
+			-- or from the latest year if none is given
+			CREATE FUNCTION population_for(
+				for_year INTEGER,
+				for_state INTEGER,
+				for_county INTEGER,
+				for_race INTEGER
+			) RETURNS INTEGER AS $$
+				SELECT population
+				FROM population
+				WHERE state_id IS NOT DISTINCT FROM for_state
+				AND county_id IS NOT DISTINCT FROM for_county
+				AND race_id IS NOT DISTINCT FROM for_race
+				ORDER BY COALESCE(ABS(year - for_year), 0), year DESC
+				LIMIT 1
+			$$ LANGUAGE SQL STABLE;
+		`,
+		Down: `
+			DROP FUNCTION population_for(INTEGER, INTEGER, INTEGER, INTEGER);
+			DROP TABLE population;
+		`,
+	},
+	{
+		Version: 7,
+		Name:    "create dataset version",
+		Up: `
+			-- A single row the importer bumps, so cached
+			-- responses can tell when the data changed
+			CREATE TABLE dataset_version (
+				id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+				version INTEGER NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL
+			);
+			INSERT INTO dataset_version (version, updated_at) VALUES (1, now());
+		`,
+		Down: `
+			DROP TABLE dataset_version;
+		`,
+	},
+	{
+		Version: 8,
+		Name:    "create count views",
+		Up: `
+			-- Unfiltered counts for /incident/count, refreshed after each import
+			CREATE MATERIALIZED VIEW count_by_year AS
+				SELECT EXTRACT(YEAR FROM date)::INTEGER AS key, COUNT(1) AS count
+				FROM incident
+				WHERE date IS NOT NULL
+				GROUP BY 1;
+			CREATE MATERIALIZED VIEW count_by_race AS
+				SELECT race_id AS key, COUNT(1) AS count
+				FROM incident
+				WHERE race_id IS NOT NULL
+				GROUP BY 1;
+			CREATE MATERIALIZED VIEW count_by_cause AS
+				SELECT cause_id AS key, COUNT(1) AS count
+				FROM incident
+				WHERE cause_id IS NOT NULL
+				GROUP BY 1;
+			CREATE MATERIALIZED VIEW count_by_agency AS
+				SELECT agency_id AS key, COUNT(1) AS count
+				FROM incident
+				WHERE agency_id IS NOT NULL
+				GROUP BY 1;
+			CREATE MATERIALIZED VIEW count_by_state AS
+				SELECT city.state_id AS key, COUNT(1) AS count
+				FROM incident
+				JOIN city ON incident.city_id = city.id
+				WHERE city.state_id IS NOT NULL
+				GROUP BY 1;
+
+			CREATE FUNCTION refresh_counts() RETURNS VOID AS $$
+			BEGIN
+				REFRESH MATERIALIZED VIEW count_by_year;
+				REFRESH MATERIALIZED VIEW count_by_race;
+				REFRESH MATERIALIZED VIEW count_by_cause;
+				REFRESH MATERIALIZED VIEW count_by_agency;
+				REFRESH MATERIALIZED VIEW count_by_state;
+			END
+			$$ LANGUAGE plpgsql;
+		`,
+		Down: `
+			DROP FUNCTION refresh_counts();
+			DROP MATERIALIZED VIEW count_by_state;
+			DROP MATERIALIZED VIEW count_by_agency;
+			DROP MATERIALIZED VIEW count_by_cause;
+			DROP MATERIALIZED VIEW count_by_race;
+			DROP MATERIALIZED VIEW count_by_year;
+		`,
+	},
+	{
+		Version: 9,
+		Name:    "add agency metadata",
+		Up: `
+			ALTER TABLE agency
+				ADD COLUMN type TEXT CHECK (type IN ('municipal', 'sheriff', 'state', 'federal')),
+				ADD COLUMN state_id INTEGER REFERENCES state (id),
+				ADD COLUMN ori TEXT UNIQUE,
+				ADD COLUMN parent_id INTEGER REFERENCES agency (id);
+
+			-- Every agency involved in an incident. incident.agency_id
+			-- stays as the first one listed.
+			CREATE TABLE incident_agency (
+				incident_id INTEGER NOT NULL REFERENCES incident (id) ON DELETE CASCADE,
+				agency_id INTEGER NOT NULL REFERENCES agency (id),
+				PRIMARY KEY (incident_id, agency_id)
+			);
+			CREATE INDEX incident_agency_agency_idx ON incident_agency (agency_id);
+			INSERT INTO incident_agency (incident_id, agency_id)
+				SELECT id, agency_id
+				FROM incident
+				WHERE agency_id IS NOT NULL;
+		`,
+		Down: `
+			DROP TABLE incident_agency;
+			ALTER TABLE agency
+				DROP COLUMN parent_id,
+				DROP COLUMN ori,
+				DROP COLUMN state_id,
+				DROP COLUMN type;
+		`,
+	},
+	{
+		Version: 10,
+		Name:    "count every agency involved",
+		Up: `
+			-- Incidents count toward each agency involved, not just the lead
+			DROP MATERIALIZED VIEW count_by_agency;
+			CREATE MATERIALIZED VIEW count_by_agency AS
+				SELECT agency_id AS key, COUNT(1) AS count
+				FROM incident_agency
+				GROUP BY 1;
+		`,
+		Down: `
+			DROP MATERIALIZED VIEW count_by_agency;
+			CREATE MATERIALIZED VIEW count_by_agency AS
+				SELECT agency_id AS key, COUNT(1) AS count
+				FROM incident
+				WHERE agency_id IS NOT NULL
+				GROUP BY 1;
+		`,
+	},
+	{
+		Version: 11,
+		Name:    "add incident state",
+		Up: `
+			-- Every incident has a state, but not every one has a city
+			ALTER TABLE incident ADD COLUMN state_id INTEGER REFERENCES state (id);
+			UPDATE incident SET state_id = city.state_id
+				FROM city
+				WHERE incident.city_id = city.id;
+			CREATE INDEX incident_state_id_idx ON incident (state_id);
+
+			DROP MATERIALIZED VIEW count_by_state;
+			CREATE MATERIALIZED VIEW count_by_state AS
+				SELECT state_id AS key, COUNT(1) AS count
+				FROM incident
+				WHERE state_id IS NOT NULL
+				GROUP BY 1;
+		`,
+		Down: `
+			DROP MATERIALIZED VIEW count_by_state;
+			CREATE MATERIALIZED VIEW count_by_state AS
+				SELECT city.state_id AS key, COUNT(1) AS count
+				FROM incident
+				JOIN city ON incident.city_id = city.id
+				WHERE city.state_id IS NOT NULL
+				GROUP BY 1;
+
+			DROP INDEX incident_state_id_idx;
+			ALTER TABLE incident DROP COLUMN state_id;
+		`,
+	},
+	{
+		Version: 12,
+		Name:    "key agencies by name and state",
+		Up: `
+			-- Agencies in different states can share a name. A NULL
+			-- state is for federal agencies, which work across states.
+			ALTER TABLE agency DROP CONSTRAINT agency_name_key;
+			CREATE UNIQUE INDEX agency_key_idx ON agency (name, COALESCE(state_id, 0));
+		`,
+		Down: `
+			-- Fails if agencies in different states share a name
+			DROP INDEX agency_key_idx;
+			ALTER TABLE agency ADD CONSTRAINT agency_name_key UNIQUE (name);
+		`,
+	},
+	{
+		Version: 13,
+		Name:    "track guessed agency types",
+		Up: `
+			-- Guesses give way to later ones, types from a CSV don't.
+			-- Which existing types came from a CSV isn't known, so they
+			-- all count as guesses until the CSV is loaded again.
+			ALTER TABLE agency ADD COLUMN type_guessed BOOLEAN NOT NULL DEFAULT FALSE;
+			UPDATE agency SET type_guessed = TRUE WHERE type IS NOT NULL;
+		`,
+		Down: `
+			ALTER TABLE agency DROP COLUMN type_guessed;
+		`,
+	},
+}
@@ -0,0 +1,19 @@
+package migrate
+
+import "testing"
+
+func TestMigrationVersionsAreSequential(t *testing.T) {
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("Was version %d;\nWant %d", migration.Version, i+1)
+		}
+	}
+}
+
+func TestMigrationsAreReversible(t *testing.T) {
+	for _, migration := range migrations {
+		if migration.Up == "" || migration.Down == "" {
+			t.Errorf("Migration %d is missing up or down SQL", migration.Version)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Package openapi builds an OpenAPI 3 description of the routes
+// as they are registered with the router.
+package openapi
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Version of the OpenAPI specification the documents follow
+const Version = "3.0.3"
+
+// Document is the root of an OpenAPI description
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+// Info describes the API as a whole
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Components holds the schemas referenced from operations
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// PathItem holds the operations for one path
+type PathItem struct {
+	Get *Operation `json:"get,omitempty"`
+}
+
+// Operation describes one route
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Summary     string               `json:"summary"`
+	Tags        []string             `json:"tags,omitempty"`
+	Parameters  []Parameter          `json:"parameters,omitempty"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+// Parameter describes one path or query string parameter
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Style       string  `json:"style,omitempty"`
+	Explode     *bool   `json:"explode,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// Response describes the body sent with a status code
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType holds the schema for one content type
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// New creates an empty document
+func New(title, version string) *Document {
+	return &Document{
+		OpenAPI: Version,
+		Info:    Info{title, version},
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas: map[string]*Schema{},
+		},
+	}
+}
+
+var patternParam = regexp.MustCompile(`{([^}:]+)(:[^}]*)?}`)
+
+// Path converts a chi route pattern to an OpenAPI path,
+// removing regular expressions and trailing slashes
+func Path(pattern string) string {
+	path := patternParam.ReplaceAllString(pattern, "{$1}")
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+// AddGet documents a GET route. Named schemas in its responses are
+// moved to the components section and referenced.
+func (d *Document) AddGet(pattern string, op Operation) {
+	path := Path(pattern)
+	item, ok := d.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		d.Paths[path] = item
+	}
+	responses := map[string]*Response{}
+	for code, res := range op.Responses {
+		hoisted := &Response{res.Description, map[string]MediaType{}}
+		for contentType, media := range res.Content {
+			hoisted.Content[contentType] = MediaType{d.hoist(media.Schema)}
+		}
+		responses[code] = hoisted
+	}
+	op.Responses = responses
+	item.Get = &op
+}
+
+// OperationIDs lists the documented operations in sorted order
+func (d *Document) OperationIDs() []string {
+	ids := []string{}
+	for _, item := range d.Paths {
+		if item.Get != nil {
+			ids = append(ids, item.Get.OperationID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (d *Document) hoist(s *Schema) *Schema {
+	if s == nil {
+		return nil
+	}
+	out := *s
+	out.name = ""
+	out.Items = d.hoist(s.Items)
+	out.AdditionalProperties = d.hoist(s.AdditionalProperties)
+	if s.OneOf != nil {
+		out.OneOf = []*Schema{}
+		for _, option := range s.OneOf {
+			out.OneOf = append(out.OneOf, d.hoist(option))
+		}
+	}
+	if s.Properties != nil {
+		out.Properties = map[string]*Schema{}
+		for name, property := range s.Properties {
+			out.Properties[name] = d.hoist(property)
+		}
+	}
+	if s.name == "" {
+		return &out
+	}
+	d.Components.Schemas[s.name] = &out
+	ref := &Schema{Ref: "#/components/schemas/" + s.name}
+	if s.Nullable {
+		// Siblings of $ref are ignored, so nullability needs a wrapper
+		return &Schema{Nullable: true, AllOf: []*Schema{ref}}
+	}
+	return ref
+}
@@ -0,0 +1,51 @@
+package openapi
+
+var explodeFalse = false
+
+// Query is an optional query string parameter
+func Query(name, description string, schema *Schema) Parameter {
+	return Parameter{
+		Name:        name,
+		In:          "query",
+		Description: description,
+		Schema:      schema,
+	}
+}
+
+// QueryList is a query string parameter holding comma-separated values
+func QueryList(name, description string, items *Schema) Parameter {
+	p := Query(name, description, Array(items))
+	p.Style = "form"
+	p.Explode = &explodeFalse
+	return p
+}
+
+// PathList is a required path parameter holding comma-separated values
+func PathList(name, description string, items *Schema) Parameter {
+	return Parameter{
+		Name:        name,
+		In:          "path",
+		Description: description,
+		Required:    true,
+		Style:       "simple",
+		Schema:      Array(items),
+	}
+}
+
+// JSON is a successful response with a JSON body
+func JSON(description string, schema *Schema) *Response {
+	return &Response{
+		Description: description,
+		Content: map[string]MediaType{
+			"application/json": {schema},
+		},
+	}
+}
+
+// Responses creates a response map with a success body and the shared error body
+func Responses(success *Response, errorSchema *Schema) map[string]*Response {
+	return map[string]*Response{
+		"200":     success,
+		"default": JSON("Error", errorSchema),
+	}
+}
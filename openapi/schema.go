@@ -0,0 +1,145 @@
+package openapi
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Schema describes a JSON value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	AllOf                []*Schema          `json:"allOf,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+
+	// name is set for schemas that should be shared through components
+	name string
+}
+
+// Named marks a schema to be listed under components/schemas
+func Named(name string, s *Schema) *Schema {
+	out := *s
+	out.name = name
+	return &out
+}
+
+// Integer is an integer schema
+func Integer() *Schema {
+	return &Schema{Type: "integer"}
+}
+
+// String is a string schema
+func String() *Schema {
+	return &Schema{Type: "string"}
+}
+
+// Boolean is a boolean schema
+func Boolean() *Schema {
+	return &Schema{Type: "boolean"}
+}
+
+// Array is an array of the given items
+func Array(items *Schema) *Schema {
+	return &Schema{Type: "array", Items: items}
+}
+
+// Object is an object with the given required properties
+func Object(properties map[string]*Schema) *Schema {
+	required := []string{}
+	for name := range properties {
+		required = append(required, name)
+	}
+	sort.Strings(required)
+	return &Schema{Type: "object", Properties: properties, Required: required}
+}
+
+// OneOf is a value matching exactly one of the given schemas
+func OneOf(schemas ...*Schema) *Schema {
+	return &Schema{OneOf: schemas}
+}
+
+// Enum is a string schema limited to the given values
+func Enum(values ...string) *Schema {
+	return &Schema{Type: "string", Enum: values}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemaOf describes the JSON encoding of v using its json struct tags.
+// Pointers are nullable, other fields are required.
+func SchemaOf(v interface{}) *Schema {
+	return schemaOfType(reflect.TypeOf(v))
+}
+
+func schemaOfType(t reflect.Type) *Schema {
+	if t == timeType {
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := schemaOfType(t.Elem())
+		s.Nullable = true
+		return s
+	case reflect.Bool:
+		return Boolean()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return String()
+	case reflect.Slice, reflect.Array:
+		return Array(schemaOfType(t.Elem()))
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: schemaOfType(t.Elem())}
+	case reflect.Struct:
+		return schemaOfStruct(t)
+	default:
+		return &Schema{}
+	}
+}
+
+func schemaOfStruct(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+		name := field.Name
+		omitEmpty := false
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			parts := strings.Split(tag, ",")
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			for _, option := range parts[1:] {
+				omitEmpty = omitEmpty || option == "omitempty"
+			}
+		}
+		property := schemaOfType(field.Type)
+		s.Properties[name] = property
+		if !omitEmpty {
+			s.Required = append(s.Required, name)
+		}
+	}
+	return s
+}
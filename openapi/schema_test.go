@@ -0,0 +1,54 @@
+package openapi
+
+import (
+	"testing"
+	"time"
+)
+
+type example struct {
+	ID       int       `json:"id"`
+	Name     *string   `json:"name"`
+	Date     time.Time `json:"date"`
+	Tags     []string  `json:"tags,omitempty"`
+	Ignored  string    `json:"-"`
+	internal int
+}
+
+func TestSchemaOfStruct(t *testing.T) {
+	s := SchemaOf(example{})
+	if len(s.Properties) != 4 {
+		t.Errorf("Was %d properties;\nWant 4", len(s.Properties))
+	}
+	if !s.Properties["name"].Nullable {
+		t.Error("Expected pointer field to be nullable")
+	}
+	if s.Properties["date"].Format != "date-time" {
+		t.Errorf("Was `%s`;\nWant `date-time`", s.Properties["date"].Format)
+	}
+	if len(s.Required) != 3 {
+		t.Errorf("Was %v;\nWant [id name date]", s.Required)
+	}
+}
+
+func TestPathRemovesPatterns(t *testing.T) {
+	path := Path("/incident/detail/{id:[0-9,]+}")
+	const wanted = "/incident/detail/{id}"
+	if path != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", path, wanted)
+	}
+}
+
+func TestNamedSchemasAreReferenced(t *testing.T) {
+	doc := New("test", "1")
+	item := Named("Item", SchemaOf(example{}))
+	doc.AddGet("/items/", Operation{
+		Responses: map[string]*Response{"200": JSON("Items", Array(item))},
+	})
+	schema := doc.Paths["/items"].Get.Responses["200"].Content["application/json"].Schema
+	if schema.Items.Ref != "#/components/schemas/Item" {
+		t.Errorf("Was `%s`;\nWant `#/components/schemas/Item`", schema.Items.Ref)
+	}
+	if _, ok := doc.Components.Schemas["Item"]; !ok {
+		t.Error("Expected Item in components")
+	}
+}
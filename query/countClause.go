@@ -0,0 +1,29 @@
+package query
+
+import "fmt"
+
+type countClause struct {
+	condition Clauser
+}
+
+// NewCountClause creates a COUNT aggregate of the rows matching condition,
+// or of every row if condition is nil
+func NewCountClause(condition Clauser) Clauser {
+	return &countClause{condition}
+}
+
+// String returns a SQL snippet
+func (c *countClause) String() string {
+	if c.condition == nil || c.condition.String() == "" {
+		return "COUNT(1)"
+	}
+	return fmt.Sprintf("COUNT(1) FILTER (WHERE %s)", c.condition.String())
+}
+
+// Parameters returns the SQL query placeholder contents
+func (c *countClause) Parameters() []interface{} {
+	if c.condition == nil {
+		return []interface{}{}
+	}
+	return c.condition.Parameters()
+}
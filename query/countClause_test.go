@@ -0,0 +1,18 @@
+package query
+
+import "testing"
+
+func TestCountEveryRow(t *testing.T) {
+	query := NewQuery()
+	query.AddClause(NewSelectExprClause("test", []Clauser{NewCountClause(nil)}))
+	const wanted = "SELECT COUNT(1) FROM test"
+	try(query, wanted, t)
+}
+
+func TestCountMatchingRows(t *testing.T) {
+	query := NewQuery()
+	condition := NewCompareClause(ComparisonGreater, "a", 1)
+	query.AddClause(NewSelectExprClause("test", []Clauser{NewCountClause(nil), NewCountClause(condition)}))
+	const wanted = "SELECT COUNT(1), COUNT(1) FILTER (WHERE a > $1) FROM test"
+	try(query, wanted, t)
+}
@@ -0,0 +1,64 @@
+package query
+
+import "fmt"
+
+// TextSearchConfig is the Postgres text search configuration
+// used to parse documents and search terms
+const TextSearchConfig = "english"
+
+type fullTextSearchClause struct {
+	column string
+	term   string
+}
+
+// NewFullTextSearchClause matches a tsvector column against a web search
+// style query, supporting quoted phrases, `or` and `-` exclusions
+func NewFullTextSearchClause(column, term string) Clauser {
+	return &fullTextSearchClause{column, term}
+}
+
+// String returns a SQL snippet
+func (s *fullTextSearchClause) String() string {
+	if s.term == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s @@ %s", s.column, tsQuery())
+}
+
+// Parameters returns the SQL query placeholder contents
+func (s *fullTextSearchClause) Parameters() []interface{} {
+	if s.term == "" {
+		return []interface{}{}
+	}
+	return []interface{}{s.term}
+}
+
+type rankOrderClause struct {
+	column   string
+	term     string
+	tiebreak []string
+}
+
+// NewRankOrderClause creates an ORDER BY clause sorting the best matches
+// for a full text search first, followed by the tiebreak columns
+func NewRankOrderClause(column, term string, tiebreak []string) Clauser {
+	return &rankOrderClause{column, term, tiebreak}
+}
+
+// String returns a SQL snippet
+func (r *rankOrderClause) String() string {
+	order := fmt.Sprintf("ORDER BY ts_rank(%s, %s) DESC", r.column, tsQuery())
+	for _, column := range r.tiebreak {
+		order = fmt.Sprintf("%s, %s", order, column)
+	}
+	return order
+}
+
+// Parameters returns the SQL query placeholder contents
+func (r *rankOrderClause) Parameters() []interface{} {
+	return []interface{}{r.term}
+}
+
+func tsQuery() string {
+	return fmt.Sprintf("websearch_to_tsquery('%s', ?)", TextSearchConfig)
+}
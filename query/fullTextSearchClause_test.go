@@ -0,0 +1,24 @@
+package query
+
+import "testing"
+
+func TestFullTextSearch(t *testing.T) {
+	where := NewWhereClause(CombinatorAnd)
+	where.AddClause(NewFullTextSearchClause("document", "wellness check"))
+	query := baseQuery()
+	query.AddClause(where)
+	query.AddClause(NewRankOrderClause("document", "wellness check", []string{"id"}))
+	const wanted = "SELECT a, b FROM test " +
+		"WHERE (document @@ websearch_to_tsquery('english', $1)) " +
+		"ORDER BY ts_rank(document, websearch_to_tsquery('english', $2)) DESC, id"
+	try(query, wanted, t)
+}
+
+func TestIgnoreFullTextSearchIfSearchTermIsEmpty(t *testing.T) {
+	where := NewWhereClause(CombinatorAnd)
+	where.AddClause(NewFullTextSearchClause("document", ""))
+	query := baseQuery()
+	query.AddClause(where)
+	const wanted = "SELECT a, b FROM test"
+	try(query, wanted, t)
+}
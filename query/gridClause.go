@@ -0,0 +1,50 @@
+package query
+
+import (
+	"fmt"
+	"math"
+)
+
+type gridClause struct {
+	latitude  string
+	longitude string
+	west      float64
+	south     float64
+	east      float64
+	north     float64
+	size      int
+}
+
+// NewGridClause creates two columns holding the x and y cell of each position
+// in a size by size grid over a Web Mercator map tile. Cell y counts down
+// from the north edge. Positions should be limited to the tile's bounds.
+func NewGridClause(latitude, longitude string, west, south, east, north float64, size int) Clauser {
+	return &gridClause{latitude, longitude, west, south, east, north, size}
+}
+
+// String returns a SQL snippet
+func (g *gridClause) String() string {
+	mercator := fmt.Sprintf("LN(TAN(PI() / 4 + RADIANS(%s) / 2))", g.latitude)
+	x := fmt.Sprintf("LEAST(GREATEST(FLOOR((%s - ?) * ?), 0), ?)", g.longitude)
+	y := fmt.Sprintf("LEAST(GREATEST(FLOOR((? - %s) * ?), 0), ?)", mercator)
+	return fmt.Sprintf("%s, %s", x, y)
+}
+
+// Parameters returns the SQL query placeholder contents
+func (g *gridClause) Parameters() []interface{} {
+	size := float64(g.size)
+	top := mercatorY(g.north)
+	bottom := mercatorY(g.south)
+	return []interface{}{
+		g.west,
+		size / (g.east - g.west),
+		g.size - 1,
+		top,
+		size / (top - bottom),
+		g.size - 1,
+	}
+}
+
+func mercatorY(latitude float64) float64 {
+	return math.Log(math.Tan(math.Pi/4 + latitude*math.Pi/360))
+}
@@ -0,0 +1,21 @@
+package query
+
+import "testing"
+
+func TestGridClause(t *testing.T) {
+	query := NewQuery()
+	query.AddClause(NewSelectExprClause("test", []Clauser{
+		NewGridClause("lat", "lng", -180, -85, 180, 85, 4),
+		NewRawSQL("COUNT(1)"),
+	}))
+	query.AddClause(NewGroupClause("1, 2"))
+	const wanted = "SELECT " +
+		"LEAST(GREATEST(FLOOR((lng - $1) * $2), 0), $3), " +
+		"LEAST(GREATEST(FLOOR(($4 - LN(TAN(PI() / 4 + RADIANS(lat) / 2))) * $5), 0), $6), " +
+		"COUNT(1) FROM test GROUP BY 1, 2"
+	try(query, wanted, t)
+	params := query.Parameters()
+	if params[1] != 4.0/360 || params[2] != 3 {
+		t.Errorf("Unexpected parameters %v", params)
+	}
+}
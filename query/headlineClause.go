@@ -0,0 +1,50 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// HeadlineOptions configures the ts_headline snippets, marking matched
+// words with <mark> and joining up to three fragments with an ellipsis
+const HeadlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=3, FragmentDelimiter=\" … \""
+
+// htmlEscapes are replaced in order, ampersands first,
+// so the <mark> tags are the only markup in a headline
+var htmlEscapes = [][2]string{
+	{"&", "&amp;"},
+	{"<", "&lt;"},
+	{">", "&gt;"},
+	{`"`, "&quot;"},
+	{"'", "&#39;"},
+}
+
+type headlineClause struct {
+	column string
+	term   string
+}
+
+// NewHeadlineClause creates a ts_headline expression showing where a full
+// text search term matched in the given column. The column is HTML escaped
+// first, so the headline is safe to use as HTML.
+func NewHeadlineClause(column, term string) Clauser {
+	return &headlineClause{column, term}
+}
+
+// String returns a SQL snippet
+func (h *headlineClause) String() string {
+	return fmt.Sprintf("ts_headline('%s', %s, %s, '%s')", TextSearchConfig, escapeHTML(h.column), tsQuery(), HeadlineOptions)
+}
+
+// escapeHTML wraps a text expression in the replacements of htmlEscapes
+func escapeHTML(expression string) string {
+	for _, escape := range htmlEscapes {
+		expression = fmt.Sprintf("replace(%s, '%s', '%s')", expression, strings.ReplaceAll(escape[0], "'", "''"), escape[1])
+	}
+	return expression
+}
+
+// Parameters returns the SQL query placeholder contents
+func (h *headlineClause) Parameters() []interface{} {
+	return []interface{}{h.term}
+}
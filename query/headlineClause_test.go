@@ -0,0 +1,19 @@
+package query
+
+import "testing"
+
+func TestHeadlineColumn(t *testing.T) {
+	columns := []Clauser{
+		NewRawSQL("id"),
+		NewHeadlineClause("body", "taser"),
+	}
+	query := NewQuery()
+	query.AddClause(NewSelectExprClause("test", columns))
+	where := NewWhereClause(CombinatorAnd)
+	where.AddClause(NewCompareClause(ComparisonEqual, "id", 3))
+	query.AddClause(where)
+	const wanted = "SELECT id, ts_headline('english', replace(replace(replace(replace(replace(body, " +
+		"'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '\"', '&quot;'), '''', '&#39;'), websearch_to_tsquery('english', $1), '" +
+		HeadlineOptions + "') FROM test WHERE (id = $2)"
+	try(query, wanted, t)
+}
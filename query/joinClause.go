@@ -3,16 +3,23 @@ package query
 import "fmt"
 
 type joinClause struct {
+	kind  string
 	table string
 }
 
 // NewJoinClause creates a new join clause
 func NewJoinClause(table string) Clauser {
-	return &joinClause{table}
+	return &joinClause{"JOIN", table}
+}
+
+// NewLeftJoinClause creates a join clause that keeps rows
+// without a match in the joined table
+func NewLeftJoinClause(table string) Clauser {
+	return &joinClause{"LEFT JOIN", table}
 }
 
 func (j *joinClause) String() string {
-	return fmt.Sprintf("JOIN %s ON %s_id=%s.id", j.table, j.table, j.table)
+	return fmt.Sprintf("%s %s ON %s_id=%s.id", j.kind, j.table, j.table, j.table)
 }
 
 func (j *joinClause) Parameters() []interface{} {
@@ -0,0 +1,11 @@
+package query
+
+import "testing"
+
+func TestJoinClause(t *testing.T) {
+	query := baseQuery()
+	query.AddClause(NewJoinClause("city"))
+	query.AddClause(NewLeftJoinClause("race"))
+	const wanted = "SELECT a, b FROM test JOIN city ON city_id=city.id LEFT JOIN race ON race_id=race.id"
+	try(query, wanted, t)
+}
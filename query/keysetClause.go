@@ -0,0 +1,65 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// NewKeysetClause creates a condition matching the rows that come after
+// the given values when sorted by columns, all in the same direction with
+// NULLs last. A nil value stands for NULL. The last column should be unique
+// and never NULL so every row has a distinct position.
+func NewKeysetClause(ordering Ordering, columns []string, values []interface{}) Clauser {
+	after := []Comparison{ComparisonGreater, ComparisonLesser}[ordering]
+	or := NewConditionsClause(CombinatorOr)
+	for i, column := range columns {
+		// Only other NULLs follow a NULL, and those are
+		// ordered by the remaining columns
+		if values[i] == nil {
+			continue
+		}
+		and := NewConditionsClause(CombinatorAnd)
+		for j := 0; j < i; j++ {
+			and.AddClause(equalClause(columns[j], values[j]))
+		}
+		beyond := NewConditionsClause(CombinatorOr)
+		beyond.AddClause(NewCompareClause(after, column, values[i]))
+		beyond.AddClause(NewRawSQL(fmt.Sprintf("%s IS NULL", column)))
+		and.AddClause(beyond)
+		or.AddClause(and)
+	}
+	return or
+}
+
+func equalClause(column string, value interface{}) Clauser {
+	if value == nil {
+		return NewRawSQL(fmt.Sprintf("%s IS NULL", column))
+	}
+	return NewCompareClause(ComparisonEqual, column, value)
+}
+
+type keysetOrderClause struct {
+	ordering Ordering
+	columns  []string
+}
+
+// NewKeysetOrderClause creates an ORDER BY clause sorting every column
+// in the same direction with NULLs last, as NewKeysetClause expects
+func NewKeysetOrderClause(ordering Ordering, columns []string) Clauser {
+	return &keysetOrderClause{ordering, columns}
+}
+
+// String returns a SQL snippet
+func (c *keysetOrderClause) String() string {
+	ordering := []string{"ASC", "DESC"}[c.ordering]
+	terms := make([]string, len(c.columns))
+	for i, column := range c.columns {
+		terms[i] = fmt.Sprintf("%s %s NULLS LAST", column, ordering)
+	}
+	return fmt.Sprintf("ORDER BY %s", strings.Join(terms, ", "))
+}
+
+// Parameters returns the SQL query placeholder contents
+func (c *keysetOrderClause) Parameters() []interface{} {
+	return []interface{}{}
+}
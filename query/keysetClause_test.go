@@ -0,0 +1,33 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestKeysetAfterValues(t *testing.T) {
+	where := NewWhereClause(CombinatorAnd)
+	where.AddClause(NewKeysetClause(OrderingAscending, []string{"age", "id"}, []interface{}{30, 12}))
+	query := baseQuery()
+	query.AddClause(where)
+	const wanted = "SELECT a, b FROM test WHERE ((((age > $1 OR age IS NULL)) OR (age = $2 AND (id > $3 OR id IS NULL))))"
+	try(query, wanted, t)
+	parameters := []interface{}{30, 30, 12}
+	if !reflect.DeepEqual(query.Parameters(), parameters) {
+		t.Errorf("Was `%v`;\nWant `%v`", query.Parameters(), parameters)
+	}
+}
+
+func TestKeysetAfterNull(t *testing.T) {
+	query := baseQuery()
+	query.AddClause(NewKeysetClause(OrderingDescending, []string{"age", "id"}, []interface{}{nil, 12}))
+	const wanted = "SELECT a, b FROM test ((age IS NULL AND (id < $1 OR id IS NULL)))"
+	try(query, wanted, t)
+}
+
+func TestKeysetOrder(t *testing.T) {
+	query := baseQuery()
+	query.AddClause(NewKeysetOrderClause(OrderingDescending, []string{"age", "id"}))
+	const wanted = "SELECT a, b FROM test ORDER BY age DESC NULLS LAST, id DESC NULLS LAST"
+	try(query, wanted, t)
+}
@@ -0,0 +1,28 @@
+package query
+
+import "fmt"
+
+type selectExprClause struct {
+	table   string
+	columns Subclauser
+}
+
+// NewSelectExprClause creates a SELECT FROM clause whose
+// columns are expressions that may have parameters
+func NewSelectExprClause(table string, columns []Clauser) Clauser {
+	expr := NewSubexpression(", ")
+	for _, column := range columns {
+		expr.AddClause(column)
+	}
+	return &selectExprClause{table, expr}
+}
+
+// String returns a SQL snippet
+func (s *selectExprClause) String() string {
+	return fmt.Sprintf("SELECT %s FROM %s", s.columns.String(), s.table)
+}
+
+// Parameters returns the SQL query placeholder contents
+func (s *selectExprClause) Parameters() []interface{} {
+	return s.columns.Parameters()
+}
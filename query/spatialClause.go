@@ -0,0 +1,67 @@
+package query
+
+import "fmt"
+
+type boundingBoxClause struct {
+	latitude  string
+	longitude string
+	minLng    float64
+	minLat    float64
+	maxLng    float64
+	maxLat    float64
+}
+
+// NewBoundingBoxClause matches positions inside a longitude and latitude
+// range. Boxes with minLng greater than maxLng cross the antimeridian.
+func NewBoundingBoxClause(latitude, longitude string, minLng, minLat, maxLng, maxLat float64) Clauser {
+	return &boundingBoxClause{latitude, longitude, minLng, minLat, maxLng, maxLat}
+}
+
+// String returns a SQL snippet
+func (b *boundingBoxClause) String() string {
+	if b.minLng > b.maxLng {
+		return fmt.Sprintf(
+			"(%s BETWEEN ? AND ? AND (%s >= ? OR %s <= ?))",
+			b.latitude, b.longitude, b.longitude,
+		)
+	}
+	return fmt.Sprintf(
+		"(%s BETWEEN ? AND ? AND %s BETWEEN ? AND ?)",
+		b.latitude, b.longitude,
+	)
+}
+
+// Parameters returns the SQL query placeholder contents
+func (b *boundingBoxClause) Parameters() []interface{} {
+	return []interface{}{b.minLat, b.maxLat, b.minLng, b.maxLng}
+}
+
+type radiusClause struct {
+	latitude  string
+	longitude string
+	lat       float64
+	lng       float64
+	meters    float64
+}
+
+// NewRadiusClause matches positions within a great circle distance of a
+// point using the earthdistance extension. The earth_box test can use a
+// GiST index on ll_to_earth(latitude, longitude) and the earth_distance
+// test trims the corners of the box.
+func NewRadiusClause(latitude, longitude string, lat, lng, meters float64) Clauser {
+	return &radiusClause{latitude, longitude, lat, lng, meters}
+}
+
+// String returns a SQL snippet
+func (c *radiusClause) String() string {
+	position := fmt.Sprintf("ll_to_earth(%s, %s)", c.latitude, c.longitude)
+	return fmt.Sprintf(
+		"(earth_box(ll_to_earth(?, ?), ?) @> %s AND earth_distance(ll_to_earth(?, ?), %s) <= ?)",
+		position, position,
+	)
+}
+
+// Parameters returns the SQL query placeholder contents
+func (c *radiusClause) Parameters() []interface{} {
+	return []interface{}{c.lat, c.lng, c.meters, c.lat, c.lng, c.meters}
+}
@@ -0,0 +1,36 @@
+package query
+
+import "testing"
+
+func TestBoundingBoxClause(t *testing.T) {
+	where := NewWhereClause(CombinatorAnd)
+	where.AddClause(NewBoundingBoxClause("lat", "lng", -120, 35, -119, 36))
+	query := baseQuery()
+	query.AddClause(where)
+	const wanted = "SELECT a, b FROM test WHERE ((lat BETWEEN $1 AND $2 AND lng BETWEEN $3 AND $4))"
+	try(query, wanted, t)
+}
+
+func TestBoundingBoxCrossingAntimeridian(t *testing.T) {
+	where := NewWhereClause(CombinatorAnd)
+	where.AddClause(NewBoundingBoxClause("lat", "lng", 170, 50, -170, 60))
+	query := baseQuery()
+	query.AddClause(where)
+	const wanted = "SELECT a, b FROM test WHERE ((lat BETWEEN $1 AND $2 AND (lng >= $3 OR lng <= $4)))"
+	try(query, wanted, t)
+}
+
+func TestRadiusClause(t *testing.T) {
+	where := NewWhereClause(CombinatorAnd)
+	where.AddClause(NewRadiusClause("lat", "lng", 45.5, -122.6, 1000))
+	query := baseQuery()
+	query.AddClause(where)
+	const wanted = "SELECT a, b FROM test WHERE (" +
+		"(earth_box(ll_to_earth($1, $2), $3) @> ll_to_earth(lat, lng) AND " +
+		"earth_distance(ll_to_earth($4, $5), ll_to_earth(lat, lng)) <= $6))"
+	try(query, wanted, t)
+	params := query.Parameters()
+	if len(params) != 6 || params[2] != 1000.0 {
+		t.Errorf("Unexpected parameters %v", params)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/tim-harding/fatal-encounters-server/openapi"
+	"github.com/tim-harding/fatal-encounters-server/routes/agencyroute"
+	"github.com/tim-harding/fatal-encounters-server/routes/cityroute"
+	"github.com/tim-harding/fatal-encounters-server/routes/enumroute"
+	"github.com/tim-harding/fatal-encounters-server/routes/incidentroute"
+	"github.com/tim-harding/fatal-encounters-server/routes/stateroute"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+const (
+	apiTitle   = "Fatal Encounters API"
+	apiVersion = "1.0.0"
+)
+
+var enumTables = []string{
+	"cause",
+	"county",
+	"race",
+	"use_of_force",
+}
+
+// routes registers handlers together with their documentation
+type routes struct {
+	chi.Router
+	s      *shared.Server
+	doc    *openapi.Document
+	prefix string
+}
+
+func newRouter(s *shared.Server) http.Handler {
+	r := chi.NewRouter()
+	r.Use(middleware.Logger)
+	s.Use(r)
+	doc := openapi.New(apiTitle, apiVersion)
+	root := &routes{r, s, doc, ""}
+
+	city := cityroute.New(s)
+	root.route("/city", func(r *routes) {
+		r.get("/", city.HandleBaseRoute, cityroute.BaseOperation())
+		r.get("/{id}", city.HandleIDRoute, cityroute.IDOperation())
+	})
+	state := stateroute.New(s)
+	root.route("/state", func(r *routes) {
+		r.get("/", state.HandleBaseRoute, stateroute.BaseOperation())
+		r.get("/{id}", state.HandleIDRoute, stateroute.IDOperation())
+	})
+	incident := incidentroute.New(s)
+	agency := agencyroute.New(s)
+	root.route("/agency", func(r *routes) {
+		r.get("/", agency.HandleBaseRoute, agencyroute.BaseOperation())
+		r.get("/{id}", agency.HandleIDRoute, agencyroute.IDOperation())
+		r.get("/{id:[0-9]+}/profile", incident.HandleAgencyProfileRoute, incidentroute.AgencyProfileOperation())
+	})
+	for _, table := range enumTables {
+		route := fmt.Sprintf("/%s", table)
+		enum := enumroute.New(s, table)
+		root.route(route, func(r *routes) {
+			r.get("/", enum.HandleBaseRoute, enumroute.BaseOperation(table))
+			r.get("/{id}", enum.HandleIDRoute, enumroute.IDOperation(table))
+		})
+	}
+	root.route("/incident", func(r *routes) {
+		r.get("/filter", incident.HandleIncidentFilterRoute, incidentroute.FilterOperation())
+		r.get("/position", incident.HandleIncidentPositionRoute, incidentroute.PositionOperation())
+		r.get("/detail/{id:[0-9,]+}", incident.HandleIncidentDetailRoute, incidentroute.DetailOperation())
+		r.get("/count", incident.HandleCountRoute, incidentroute.CountOperation())
+		r.get("/crosstab", incident.HandleIncidentCrosstabRoute, incidentroute.CrosstabOperation())
+		r.get("/timeseries", incident.HandleIncidentTimeseriesRoute, incidentroute.TimeseriesOperation())
+		r.get("/export", incident.HandleIncidentExportRoute, incidentroute.ExportOperation())
+		r.get("/tiles/{z:[0-9]+}/{x:[0-9]+}/{y:[0-9]+}", incident.HandleIncidentTilesRoute, incidentroute.TilesOperation())
+	})
+
+	r.Get("/openapi.json", shared.HandleDocument(doc))
+	return r
+}
+
+func (rs *routes) route(prefix string, fn func(r *routes)) {
+	rs.Route(prefix, func(r chi.Router) {
+		fn(&routes{r, rs.s, rs.doc, rs.prefix + prefix})
+	})
+}
+
+// get registers a handler with its documentation and
+// the query timeout for its full route pattern
+func (rs *routes) get(pattern string, handler http.HandlerFunc, op openapi.Operation) {
+	full := rs.prefix + pattern
+	path := openapi.Path(full)
+	op.Parameters = append(op.Parameters, shared.StrictParameter())
+	rs.With(rs.s.Timeout(path)).Get(pattern, handler)
+	rs.doc.AddGet(path, op)
+}
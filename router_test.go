@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi"
+	"github.com/tim-harding/fatal-encounters-server/config"
+	"github.com/tim-harding/fatal-encounters-server/openapi"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+func TestEveryRouteIsDocumented(t *testing.T) {
+	r := newRouter(shared.NewServer(nil, config.Default())).(*chi.Mux)
+	doc := fetchDocument(t, r)
+
+	chi.Walk(r, func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		path := openapi.Path(route)
+		if path == "/openapi.json" {
+			return nil
+		}
+		item, ok := doc.Paths[path]
+		if !ok || item.Get == nil {
+			t.Errorf("%s %s is not documented", method, path)
+		}
+		return nil
+	})
+}
+
+func TestOperationIDsAreUnique(t *testing.T) {
+	doc := fetchDocument(t, newRouter(shared.NewServer(nil, config.Default())))
+	seen := map[string]bool{}
+	for _, id := range doc.OperationIDs() {
+		if seen[id] {
+			t.Errorf("Duplicate operation ID %s", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestRouteTimeoutCancelsQuery(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	mock.ExpectQuery("SELECT .* FROM state").
+		WillDelayFor(time.Second).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "shortname"}))
+
+	cfg := config.Default()
+	cfg.CacheSize = 0
+	cfg.RouteTimeouts["/state/{id}"] = config.Duration{Duration: 10 * time.Millisecond}
+	r := newRouter(shared.NewServer(db, cfg))
+
+	w := httptest.NewRecorder()
+	start := time.Now()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/state/1", nil))
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Errorf("Query ran for %v instead of being canceled", elapsed)
+	}
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	expected := `{"code":503,"message":"Service Unavailable"}`
+	if body := strings.TrimSpace(w.Body.String()); body != expected {
+		t.Errorf("Expected %s, got %s", expected, body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func fetchDocument(t *testing.T, r http.Handler) openapi.Document {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	doc := openapi.Document{}
+	err := json.NewDecoder(w.Body).Decode(&doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
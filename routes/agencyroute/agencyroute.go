@@ -0,0 +1,127 @@
+package agencyroute
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/tim-harding/fatal-encounters-server/openapi"
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+type agency struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Type   *string `json:"type"`
+	State  *int    `json:"state"`
+	ORI    *string `json:"ori"`
+	Parent *int    `json:"parent"`
+}
+
+var desiredRowNames = [...]string{
+	"id",
+	"name",
+	"type",
+	"state_id",
+	"ori",
+	"parent_id",
+}
+
+var agencySchema = openapi.Named("Agency", openapi.SchemaOf(agency{}))
+
+// Handler responds to /agency routes
+type Handler struct {
+	*shared.Server
+}
+
+// New creates a handler for /agency routes
+func New(s *shared.Server) *Handler {
+	return &Handler{s}
+}
+
+// HandleBaseRoute responds to /agency queries
+func (h *Handler) HandleBaseRoute(w http.ResponseWriter, r *http.Request) {
+	h.HandleListRoute(w, r, buildBaseQuery(r), orderClause(), translateRow)
+}
+
+// HandleIDRoute responds to /agency/{id} queries
+func (h *Handler) HandleIDRoute(w http.ResponseWriter, r *http.Request) {
+	h.Server.HandleIDRoute(w, r, selectClause(), translateRow, "agency")
+}
+
+// BaseOperation documents /agency
+func BaseOperation() openapi.Operation {
+	parameters := append(
+		shared.ListParameters(),
+		openapi.QueryList("state_id", "Only agencies in these states", openapi.Integer()),
+		openapi.QueryList("parent_id", "Only agencies under these agencies", openapi.Integer()),
+		openapi.Query("type", "Only agencies of this type", openapi.Enum(shared.AgencyTypes...)),
+	)
+	return openapi.Operation{
+		OperationID: "listAgencies",
+		Summary:     "List agencies ordered by name",
+		Tags:        []string{"agency"},
+		Parameters:  parameters,
+		Responses:   shared.PagedListResponses("Agencies", agencySchema),
+	}
+}
+
+// IDOperation documents /agency/{id}
+func IDOperation() openapi.Operation {
+	return openapi.Operation{
+		OperationID: "getAgencies",
+		Summary:     "Get agencies by ID",
+		Tags:        []string{"agency"},
+		Parameters:  []openapi.Parameter{shared.IDParameter()},
+		Responses:   shared.ListResponses("Agencies", agencySchema),
+	}
+}
+
+func buildBaseQuery(r *http.Request) query.Clauser {
+	q := query.NewSubexpression(" ")
+	q.AddClause(selectClause())
+	q.AddClause(whereClause(r))
+	return q
+}
+
+func selectClause() query.Clauser {
+	return query.NewSelectClause("agency", desiredRowNames[:])
+}
+
+func whereClause(r *http.Request) query.Clauser {
+	w := query.NewWhereClause(query.CombinatorAnd)
+	w.AddClause(shared.InClause(r, "state_id"))
+	w.AddClause(shared.InClause(r, "parent_id"))
+	w.AddClause(typeClause(r))
+	w.AddClause(shared.SearchClause(r, "name"))
+	w.AddClause(shared.IgnoreClause(r, "agency"))
+	return w
+}
+
+func typeClause(r *http.Request) query.Clauser {
+	querystrings, ok := r.URL.Query()["type"]
+	if !ok {
+		return nil
+	}
+	if !shared.IsAgencyType(querystrings[0]) {
+		shared.InvalidParam(r, "type", "expected one of "+strings.Join(shared.AgencyTypes, ", "))
+		return nil
+	}
+	return query.NewCompareClause(query.ComparisonEqual, "type", querystrings[0])
+}
+
+func orderClause() query.Clauser {
+	order := query.OrderingAscending
+	columns := []string{"name"}
+	return query.NewOrderClause(order, columns)
+}
+
+func translateRow(rows *sql.Rows) (interface{}, error) {
+	row := agency{}
+	err := rows.Scan(&row.ID, &row.Name, &row.Type, &row.State, &row.ORI, &row.Parent)
+	if err != nil {
+		return nil, err
+	}
+	return row, nil
+}
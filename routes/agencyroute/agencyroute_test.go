@@ -0,0 +1,40 @@
+package agencyroute
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/tim-harding/fatal-encounters-server/config"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+func newHandler(t *testing.T) (*Handler, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(shared.NewServer(db, config.Default())), mock
+}
+
+func TestBaseRouteByType(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT id, name, type, state_id, ori, parent_id FROM agency "+
+		"WHERE (state_id IN ($1) AND type = $2) ORDER BY name ASC NULLS LAST LIMIT $3").
+		WithArgs(38, "sheriff", 6).
+		WillReturnRows(sqlmock.NewRows(desiredRowNames[:]).
+			AddRow(4, "Multnomah County Sheriff's Office", "sheriff", 38, "OR0260000", nil))
+
+	w := httptest.NewRecorder()
+	h.HandleBaseRoute(w, httptest.NewRequest("GET", "/agency?state_id=38&type=sheriff", nil))
+
+	const wanted = `{"rows":[{"id":4,"name":"Multnomah County Sheriff's Office","type":"sheriff",` +
+		`"state":38,"ori":"OR0260000","parent":null}]}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
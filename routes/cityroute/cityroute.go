@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"net/http"
 
+	"github.com/tim-harding/fatal-encounters-server/openapi"
 	"github.com/tim-harding/fatal-encounters-server/query"
 	"github.com/tim-harding/fatal-encounters-server/shared"
 )
@@ -20,22 +21,58 @@ var desiredRowNames = [...]string{
 	"state_id",
 }
 
+var citySchema = openapi.Named("City", openapi.SchemaOf(city{}))
+
+// Handler responds to /city routes
+type Handler struct {
+	*shared.Server
+}
+
+// New creates a handler for /city routes
+func New(s *shared.Server) *Handler {
+	return &Handler{s}
+}
+
 // HandleBaseRoute responds to /city queries
-func HandleBaseRoute(w http.ResponseWriter, r *http.Request) {
-	shared.HandleRoute(w, r, buildBaseQuery(r), translateRow)
+func (h *Handler) HandleBaseRoute(w http.ResponseWriter, r *http.Request) {
+	h.HandleListRoute(w, r, buildBaseQuery(r), orderClause(), translateRow)
 }
 
 // HandleIDRoute responds to /city/{id} queries
-func HandleIDRoute(w http.ResponseWriter, r *http.Request) {
-	shared.HandleIDRoute(w, r, selectClause(), translateRow, "city")
+func (h *Handler) HandleIDRoute(w http.ResponseWriter, r *http.Request) {
+	h.Server.HandleIDRoute(w, r, selectClause(), translateRow, "city")
+}
+
+// BaseOperation documents /city
+func BaseOperation() openapi.Operation {
+	parameters := append(
+		shared.ListParameters(),
+		openapi.QueryList("state_id", "Only cities in these states", openapi.Integer()),
+	)
+	return openapi.Operation{
+		OperationID: "listCities",
+		Summary:     "List cities ordered by name",
+		Tags:        []string{"city"},
+		Parameters:  parameters,
+		Responses:   shared.PagedListResponses("Cities", citySchema),
+	}
+}
+
+// IDOperation documents /city/{id}
+func IDOperation() openapi.Operation {
+	return openapi.Operation{
+		OperationID: "getCities",
+		Summary:     "Get cities by ID",
+		Tags:        []string{"city"},
+		Parameters:  []openapi.Parameter{shared.IDParameter()},
+		Responses:   shared.ListResponses("Cities", citySchema),
+	}
 }
 
 func buildBaseQuery(r *http.Request) query.Clauser {
-	q := query.NewQuery()
+	q := query.NewSubexpression(" ")
 	q.AddClause(selectClause())
 	q.AddClause(whereClause(r))
-	q.AddClause(orderClause())
-	q.AddClause(shared.LimitClause(r))
 	return q
 }
 
@@ -46,7 +83,7 @@ func selectClause() query.Clauser {
 func whereClause(r *http.Request) query.Clauser {
 	w := query.NewWhereClause(query.CombinatorAnd)
 	w.AddClause(shared.InClause(r, "state_id"))
-	w.AddClause(shared.SearchClause(r))
+	w.AddClause(shared.SearchClause(r, "name"))
 	w.AddClause(shared.IgnoreClause(r, "city"))
 	return w
 }
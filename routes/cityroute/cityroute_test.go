@@ -0,0 +1,113 @@
+package cityroute
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/tim-harding/fatal-encounters-server/config"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+func newHandler(t *testing.T) (*Handler, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(shared.NewServer(db, config.Default())), mock
+}
+
+func TestBaseRoute(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT id, name, state_id FROM city WHERE (state_id IN ($1)) ORDER BY name, state_id, id ASC NULLS LAST LIMIT $2").
+		WithArgs(5, 6).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "state_id"}).AddRow(1, "Reno", 5))
+
+	w := httptest.NewRecorder()
+	h.HandleBaseRoute(w, httptest.NewRequest("GET", "/city?state_id=5", nil))
+
+	const wanted = `{"rows":[{"id":1,"name":"Reno","state":5}]}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBaseRouteDatabaseError(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT id, name, state_id FROM city ORDER BY name, state_id, id ASC NULLS LAST LIMIT $1").
+		WillReturnError(sqlmock.ErrCancelled)
+
+	w := httptest.NewRecorder()
+	h.HandleBaseRoute(w, httptest.NewRequest("GET", "/city", nil))
+
+	if w.Code != 500 {
+		t.Errorf("Was %d;\nWant 500", w.Code)
+	}
+}
+
+func TestStrictModeRejectsInvalidParameters(t *testing.T) {
+	h, mock := newHandler(t)
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/city?strict=true&count=many&state_id=5,nevada", nil)
+	h.ValidateParams(http.HandlerFunc(h.HandleBaseRoute)).ServeHTTP(w, r)
+
+	if w.Code != 400 {
+		t.Errorf("Was %d;\nWant 400", w.Code)
+	}
+	res := shared.ErrorResponse{}
+	json.NewDecoder(w.Body).Decode(&res)
+	if len(res.Details) != 2 || res.Details[0].Field != "state_id" || res.Details[1].Field != "count" {
+		t.Errorf("Unexpected details %+v", res.Details)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLenientModeIgnoresInvalidParameters(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT id, name, state_id FROM city ORDER BY name, state_id, id ASC NULLS LAST LIMIT $1").
+		WithArgs(6).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "state_id"}))
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/city?count=many", nil)
+	h.ValidateParams(http.HandlerFunc(h.HandleBaseRoute)).ServeHTTP(w, r)
+
+	if w.Code != 200 {
+		t.Errorf("Was %d;\nWant 200", w.Code)
+	}
+}
+
+func TestIncludeTotal(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT COUNT(1) FROM (SELECT id, name, state_id FROM city WHERE (state_id IN ($1))) AS counted").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(5))
+	mock.ExpectQuery("SELECT id, name, state_id FROM city WHERE (state_id IN ($1)) ORDER BY name, state_id, id ASC NULLS LAST LIMIT $2 OFFSET $3").
+		WithArgs(5, 2, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "state_id"}).AddRow(1, "Reno", 5).AddRow(2, "Sparks", 5))
+
+	w := httptest.NewRecorder()
+	h.HandleBaseRoute(w, httptest.NewRequest("GET", "/city?state_id=5&count=2&page=1&includeTotal=true", nil))
+
+	const wanted = `{"count":2,"hasMore":true,"page":1,"rows":[{"id":1,"name":"Reno","state":5},{"id":2,"name":"Sparks","state":5}],"total":5}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	const link = `</city?count=2&includeTotal=true&page=0&state_id=5>; rel="prev", ` +
+		`</city?count=2&includeTotal=true&page=2&state_id=5>; rel="next"`
+	if w.Header().Get("Link") != link {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Header().Get("Link"), link)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
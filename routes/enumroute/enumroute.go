@@ -3,7 +3,9 @@ package enumroute
 import (
 	"database/sql"
 	"net/http"
+	"strings"
 
+	"github.com/tim-harding/fatal-encounters-server/openapi"
 	"github.com/tim-harding/fatal-encounters-server/query"
 	"github.com/tim-harding/fatal-encounters-server/shared"
 )
@@ -13,30 +15,65 @@ type enum struct {
 	Name string `json:"name"`
 }
 
-// HandleBaseRouteFactory creates functions to respond to queries
-// on enumeration tables that include id and name
-func HandleBaseRouteFactory(tableName string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		query := buildQuery(r, tableName)
-		shared.HandleRoute(w, r, query, translateRow)
+var enumSchema = openapi.Named("Enum", openapi.SchemaOf(enum{}))
+
+// Handler responds to queries on enumeration tables
+// that include id and name
+type Handler struct {
+	*shared.Server
+	table string
+}
+
+// New creates a handler for the given enumeration table
+func New(s *shared.Server, table string) *Handler {
+	return &Handler{s, table}
+}
+
+// HandleBaseRoute responds to /{table} queries
+func (h *Handler) HandleBaseRoute(w http.ResponseWriter, r *http.Request) {
+	h.HandleListRoute(w, r, buildQuery(r, h.table), orderClause(), translateRow)
+}
+
+// HandleIDRoute responds to /{table}/{id} queries
+func (h *Handler) HandleIDRoute(w http.ResponseWriter, r *http.Request) {
+	h.Server.HandleIDRoute(w, r, selectClause(h.table), translateRow, h.table)
+}
+
+// BaseOperation documents /{table}
+func BaseOperation(table string) openapi.Operation {
+	return openapi.Operation{
+		OperationID: "list" + operationName(table),
+		Summary:     "List " + table + " values ordered by name",
+		Tags:        []string{table},
+		Parameters:  shared.ListParameters(),
+		Responses:   shared.PagedListResponses("Values", enumSchema),
+	}
+}
+
+// IDOperation documents /{table}/{id}
+func IDOperation(table string) openapi.Operation {
+	return openapi.Operation{
+		OperationID: "get" + operationName(table),
+		Summary:     "Get " + table + " values by ID",
+		Tags:        []string{table},
+		Parameters:  []openapi.Parameter{shared.IDParameter()},
+		Responses:   shared.ListResponses("Values", enumSchema),
 	}
 }
 
-// HandleIDRouteFactory creates functions to respond to queries
-// on enumeration tables that include id and name
-func HandleIDRouteFactory(table string) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		query := buildQuery(r, table)
-		shared.HandleIDRoute(w, r, query, translateRow, "tableName")
+// operationName converts a table name like use_of_force to UseOfForce
+func operationName(table string) string {
+	words := strings.Split(table, "_")
+	for i, word := range words {
+		words[i] = strings.ToUpper(word[:1]) + word[1:]
 	}
+	return strings.Join(words, "")
 }
 
 func buildQuery(r *http.Request, table string) query.Clauser {
-	q := query.NewQuery()
+	q := query.NewSubexpression(" ")
 	q.AddClause(selectClause(table))
 	q.AddClause(whereClause(r, table))
-	q.AddClause(orderClause())
-	q.AddClause(shared.LimitClause(r))
 	return q
 }
 
@@ -50,7 +87,7 @@ func selectClause(tableName string) query.Clauser {
 
 func whereClause(r *http.Request, table string) query.Clauser {
 	w := query.NewWhereClause(query.CombinatorAnd)
-	w.AddClause(shared.SearchClause(r))
+	w.AddClause(shared.SearchClause(r, "name"))
 	w.AddClause(shared.IgnoreClause(r, table))
 	return w
 }
@@ -0,0 +1,39 @@
+package enumroute
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi"
+	"github.com/tim-harding/fatal-encounters-server/config"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+func TestIDRoute(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	h := New(shared.NewServer(db, config.Default()), "race")
+	mock.ExpectQuery("SELECT id, name FROM race WHERE (race.id IN ($1, $2))").
+		WithArgs(2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(2, "Asian").AddRow(3, "Hispanic"))
+
+	routeContext := chi.NewRouteContext()
+	routeContext.URLParams.Add("id", "2,3")
+	r := httptest.NewRequest("GET", "/race/2,3", nil)
+	r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, routeContext))
+	w := httptest.NewRecorder()
+	h.HandleIDRoute(w, r)
+
+	const wanted = `{"rows":[{"id":2,"name":"Asian"},{"id":3,"name":"Hispanic"}]}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -38,6 +38,18 @@ var (
 	}
 )
 
+// searchVectorColumn holds the document searched by the `q` parameter
+const searchVectorColumn = "incident.search_vector"
+
+// headlineColumn is excerpted to show where the `q` parameter matched
+const headlineColumn = "incident.description"
+
+// dateLayout is the format of the dateMin and dateMax parameters
+const dateLayout = "2006-Jan-02"
+
+// isoDateLayout formats dates in responses, exports and cursors
+const isoDateLayout = "2006-01-02"
+
 // Row names
 // ------------------------------------------------------------
 
@@ -81,10 +93,16 @@ var (
 
 			"city.id",
 			"city.name",
+
+			agenciesColumn,
 		},
 	}
 )
 
+// agenciesColumn is a JSON array of every agency involved in an incident
+const agenciesColumn = `COALESCE((SELECT json_agg(json_build_object('id', agency.id, 'name', agency.name) ORDER BY agency.name) ` +
+	`FROM incident_agency JOIN agency ON agency_id=agency.id WHERE incident_id=incident.id), '[]')`
+
 type rowKind int
 
 const (
@@ -139,32 +157,61 @@ const (
 			FROM filtered
 		)
 		AND %s IS NOT NULL
-		GROUP BY 1
-		ORDER BY 1
 	`
+	sqlNotNull = "WHERE %s IS NOT NULL"
 )
 
+// Facets
+// ------------------------------------------------------------
+
+// facet is a dimension /incident/count can tally incidents by
+type facet struct {
+	// Column is left out of the counts where NULL
+	Column string
+	// Key is the expression grouped on, with %s for the column.
+	// It must be NULL where the column is.
+	Key string
+	// Population is the state, county or race population
+	// the key is divided by, if the facet has rates
+	Population string
+	// Link joins a table with several keys per incident, if the column
+	// comes from one. Incidents count once toward each of their keys.
+	Link string
+}
+
+// sqlAgencyLink joins every agency involved in an incident
+const sqlAgencyLink = "LEFT JOIN incident_agency ON incident_agency.incident_id = incident.id"
+
 var (
-	orderColumns = [...]orderColumn{
-		{
-			"race",
-			"race_id",
-			"%s",
-		},
-		{
-			"cause",
-			"cause_id",
-			"%s",
-		},
-		{
-			"year",
-			"date",
-			"EXTRACT(YEAR FROM incident.%s) AS yyyy",
-		},
-		{
-			"age",
-			"age",
-			"%s",
-		},
+	facets = map[string]facet{
+		"race":         {"incident.race_id", "%s", "race", ""},
+		"cause":        {"incident.cause_id", "%s", "", ""},
+		"agency":       {"incident_agency.agency_id", "%s", "", sqlAgencyLink},
+		"county":       {"incident.county_id", "%s", "county", ""},
+		"city":         {"incident.city_id", "%s", "", ""},
+		"use_of_force": {"incident.use_of_force_id", "%s", "", ""},
+		"state":        {"incident.state_id", "%s", "state", ""},
+		"gender":       {"incident.is_male", "CASE %s WHEN TRUE THEN 'male' WHEN FALSE THEN 'female' END", "", ""},
+		"year":         {"incident.date", "EXTRACT(YEAR FROM %s)::INTEGER", "", ""},
+		"month":        {"incident.date", "EXTRACT(MONTH FROM %s)::INTEGER", "", ""},
+		"age":          {"incident.age", "%s", "", ""},
+	}
+
+	// countViews are materialized views holding the unfiltered
+	// key and count columns of a facet, refreshed on import
+	countViews = map[string]string{
+		"year":   "count_by_year",
+		"race":   "count_by_race",
+		"cause":  "count_by_cause",
+		"agency": "count_by_agency",
+		"state":  "count_by_state",
+	}
+
+	// defaultFacets are counted when the facets parameter is not given
+	defaultFacets = []string{
+		"race",
+		"cause",
+		"year",
+		"age",
 	}
 )
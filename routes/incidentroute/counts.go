@@ -1,19 +1,24 @@
 package incidentroute
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/tim-harding/fatal-encounters-server/query"
 	"github.com/tim-harding/fatal-encounters-server/shared"
 )
 
 type countFor struct {
-	Key   int `json:"key"`
-	Count int `json:"count"`
+	// Key is an ID, year, month, age or gender depending on the facet
+	Key   interface{} `json:"key"`
+	Count int         `json:"count"`
+	// Rate is per 100,000 people, if requested and the population is known
+	Rate *float64 `json:"rate,omitempty"`
 }
 
 type countsResponse struct {
@@ -21,63 +26,81 @@ type countsResponse struct {
 	Rows   []int                 `json:"rows"`
 }
 
-type orderColumn struct {
-	Name       string
-	Column     string
-	translator string
+// queryer runs queries on a database or in a transaction
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 }
 
-func (o *orderColumn) Translated() string {
-	return fmt.Sprintf(o.translator, o.Column)
-}
-
-// HandleCountRoute handles requests to /incident/count
-func HandleCountRoute(w http.ResponseWriter, r *http.Request) {
-	tx, err := shared.Db.Begin()
-	if err != nil {
-		shared.InternalError(w, err)
-		return
+// HandleCountRoute handles requests to /incident/count. Requests without
+// filters read the count views where they can, and others are answered
+// by a single countQuery.
+func (h *Handler) HandleCountRoute(w http.ResponseWriter, r *http.Request) {
+	where := whereClauseFilter(r)
+	order := orderClause(r)
+	requests := pickFacets(r)
+	rate, err := pickRate(r)
+	if err == nil {
+		err = checkRates(rate, requests)
 	}
-	_, err = tx.Exec(sqlDropTemp)
 	if err != nil {
-		shared.InternalError(w, err)
+		rateError(w, err)
 		return
 	}
-	_, err = tx.Exec(sqlCreateTemp)
-	if err != nil {
-		shared.InternalError(w, err)
+	if where.String() == "" {
+		q := allIncidents(order)
+		h.Cached(w, r, q, func(w http.ResponseWriter) bool {
+			return h.writeUnfilteredCounts(w, r, q, requests, rate != nil)
+		})
 		return
 	}
-	q := populateFiltered(r)
-	_, err = tx.Exec(q.String(), q.Parameters()...)
+	q := countQuery(where, order, requests, rate)
+	h.Cached(w, r, q, func(w http.ResponseWriter) bool {
+		res, err := h.queryCountRows(r.Context(), q, requests)
+		if err != nil {
+			shared.QueryError(w, r, err)
+			return false
+		}
+		return writeJSON(w, res)
+	})
+}
+
+// writeUnfilteredCounts reads the IDs and the count views in one snapshot,
+// so an import refreshing the views between queries can't split them
+func (h *Handler) writeUnfilteredCounts(w http.ResponseWriter, r *http.Request, q query.Clauser, requests []facetRequest, rate bool) bool {
+	ctx := r.Context()
+	tx, err := h.Store.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
 	if err != nil {
-		shared.InternalError(w, err)
-		return
+		shared.QueryError(w, r, err)
+		return false
 	}
-	ids, err := queryIds(tx)
+	ids, err := queryIds(ctx, q, tx)
 	if err != nil {
-		shared.InternalError(w, err)
-		return
+		tx.Rollback()
+		shared.QueryError(w, r, err)
+		return false
 	}
 	counts := map[string][]countFor{}
-	for _, order := range orderColumns {
-		q := countQuery(order)
-		count, err := queryCountFor(q, tx)
+	for _, request := range requests {
+		count, err := queryCountFor(ctx, unfilteredFacetQuery(request, rate), tx, rate)
 		if err != nil {
-			shared.InternalError(w, err)
-			return
+			tx.Rollback()
+			shared.QueryError(w, r, err)
+			return false
 		}
-		counts[order.Name] = count
+		counts[request.Name] = count
+	}
+	err = tx.Commit()
+	if err != nil {
+		shared.QueryError(w, r, err)
+		return false
 	}
-	tx.Commit()
-	res := countsResponse{counts, ids}
-	json.NewEncoder(w).Encode(res)
+	return writeJSON(w, countsResponse{counts, ids})
 }
 
-func queryIds(tx *sql.Tx) ([]int, error) {
-	str := allFiltered().String()
+func queryIds(ctx context.Context, query query.Clauser, db queryer) ([]int, error) {
+	str := query.String()
 	log.Printf(str)
-	rows, err := tx.Query(str)
+	rows, err := db.QueryContext(ctx, str, query.Parameters()...)
 	if err != nil {
 		return nil, err
 	}
@@ -98,10 +121,10 @@ func queryIds(tx *sql.Tx) ([]int, error) {
 	return out, nil
 }
 
-func queryCountFor(query query.Clauser, tx *sql.Tx) ([]countFor, error) {
+func queryCountFor(ctx context.Context, query query.Clauser, db queryer, rate bool) ([]countFor, error) {
 	str := query.String()
 	log.Printf(str)
-	rows, err := tx.Query(str)
+	rows, err := db.QueryContext(ctx, str, query.Parameters()...)
 	if err != nil {
 		return nil, err
 	}
@@ -109,10 +132,17 @@ func queryCountFor(query query.Clauser, tx *sql.Tx) ([]countFor, error) {
 	out := []countFor{}
 	for rows.Next() {
 		count := countFor{}
-		err := rows.Scan(&count.Key, &count.Count)
+		targets := []interface{}{&count.Key, &count.Count}
+		if rate {
+			targets = append(targets, &count.Rate)
+		}
+		err := rows.Scan(targets...)
 		if err != nil {
 			return nil, err
 		}
+		if bytes, ok := count.Key.([]byte); ok {
+			count.Key = string(bytes)
+		}
 		out = append(out, count)
 	}
 	err = rows.Err()
@@ -122,29 +152,187 @@ func queryCountFor(query query.Clauser, tx *sql.Tx) ([]countFor, error) {
 	return out, nil
 }
 
-func populateFiltered(r *http.Request) query.Clauser {
+// allIncidents selects the ID of every incident in order
+func allIncidents(order query.Clauser) query.Clauser {
 	q := query.NewQuery()
-	q.AddClause(query.NewInsertClause("filtered"))
 	q.AddClause(query.NewSelectClause("incident", []string{"incident.id"}))
-	q.AddClause(whereClauseFilter(r))
-	q.AddClause(orderClause(r))
+	q.AddClause(order)
 	return q
 }
 
-func allFiltered() query.Clauser {
+// countQuery lists the IDs of the incidents matching where, in order, and
+// counts them by each facet with GROUPING SETS, in one query. ID rows have
+// an id and position. Count rows have the index of their facet in requests,
+// the count, the rate and the key in the column of that facet. Facets with
+// a link give several rows per incident, which are counted once.
+func countQuery(where, order query.Clauser, requests []facetRequest, rate *ratePlace) query.Clauser {
+	links := facetLinks(requests)
+	ids := "SELECT id, position, NULL, NULL, NULL%s FROM filtered"
+	count := "COUNT(1)"
+	if len(links) > 0 {
+		ids = "SELECT id, MIN(position), NULL, NULL, NULL%s FROM filtered GROUP BY id"
+		count = "COUNT(DISTINCT id)"
+	}
+	position := query.NewSubexpression("")
+	position.AddClause(query.NewRawSQL("ROW_NUMBER() OVER ("))
+	position.AddClause(order)
+	position.AddClause(query.NewRawSQL(") AS position"))
+	columns := []query.Clauser{query.NewRawSQL("incident.id"), position}
+	for i, request := range requests {
+		columns = append(columns, query.NewRawSQL(fmt.Sprintf("%s AS facet%d", facetKey(request), i)))
+	}
+
 	q := query.NewQuery()
-	q.AddClause(query.NewSelectClause("filtered", []string{"id"}))
+	q.AddClause(query.NewRawSQL("WITH filtered AS ("))
+	q.AddClause(query.NewSelectExprClause("incident", columns))
+	for _, link := range links {
+		q.AddClause(query.NewRawSQL(link))
+	}
+	q.AddClause(where)
+	q.AddClause(query.NewRawSQL(")"))
+
+	nulls := strings.Repeat(", NULL", len(requests))
+	q.AddClause(query.NewRawSQL(fmt.Sprintf(ids, nulls)))
+	if len(requests) == 0 {
+		return q
+	}
+	keys := []string{}
+	sets := []string{}
+	facetIndex := []string{}
+	rates := []string{}
+	for i, request := range requests {
+		key := fmt.Sprintf("facet%d", i)
+		keys = append(keys, key)
+		sets = append(sets, fmt.Sprintf("(%s)", key))
+		facetIndex = append(facetIndex, fmt.Sprintf("WHEN GROUPING(%s) = 0 THEN %d", key, i))
+		if rate != nil {
+			// Counts span every year, so rates use the latest population.
+			// The place was checked by checkRates.
+			population, _ := facetPopulation(request, key, *rate)
+			rates = append(rates, fmt.Sprintf("WHEN GROUPING(%s) = 0 THEN %s", key, rateColumn(count, "NULL", population)))
+		}
+	}
+	rateExpr := "NULL::NUMERIC"
+	if rate != nil {
+		rateExpr = fmt.Sprintf("CASE %s END", strings.Join(rates, " "))
+	}
+	q.AddClause(query.NewRawSQL(fmt.Sprintf(
+		"UNION ALL SELECT NULL, NULL, CASE %s END, %s, %s, %s FROM filtered GROUP BY GROUPING SETS (%s)",
+		strings.Join(facetIndex, " "), count, rateExpr, strings.Join(keys, ", "), strings.Join(sets, ", "),
+	)))
 	return q
 }
 
-func countQuery(column orderColumn) query.Clauser {
-	q := query.NewQuery()
-	columns := []string{
-		column.Translated(),
-		"COUNT(1)",
+// facetLinks gets the distinct links of the facets
+func facetLinks(requests []facetRequest) []string {
+	links := []string{}
+	seen := map[string]bool{}
+	for _, request := range requests {
+		link := facets[request.Name].Link
+		if link != "" && !seen[link] {
+			links = append(links, link)
+			seen[link] = true
+		}
 	}
-	q.AddClause(query.NewSelectClause("incident", columns))
-	filtered := fmt.Sprintf(sqlFiltered, column.Column)
-	q.AddClause(query.NewRawSQL(filtered))
-	return q
+	return links
+}
+
+// queryCountRows runs a countQuery. Incidents without a key are left out of
+// the counts for that facet, which are ordered by key, or by count then key
+// and cut to the top keys if asked for.
+func (h *Handler) queryCountRows(ctx context.Context, q query.Clauser, requests []facetRequest) (countsResponse, error) {
+	res := countsResponse{map[string][]countFor{}, []int{}}
+	for _, request := range requests {
+		res.Counts[request.Name] = []countFor{}
+	}
+	rows, err := h.QueryRows(ctx, q)
+	if err != nil {
+		return res, err
+	}
+	defer rows.Close()
+	positions := []int64{}
+	for rows.Next() {
+		var id, position, facet, count sql.NullInt64
+		var rate *float64
+		keys := make([]interface{}, len(requests))
+		targets := []interface{}{&id, &position, &facet, &count, &rate}
+		for i := range keys {
+			targets = append(targets, &keys[i])
+		}
+		err := rows.Scan(targets...)
+		if err != nil {
+			return res, err
+		}
+		if id.Valid {
+			res.Rows = append(res.Rows, int(id.Int64))
+			positions = append(positions, position.Int64)
+			continue
+		}
+		key := keys[facet.Int64]
+		if key == nil {
+			continue
+		}
+		if bytes, ok := key.([]byte); ok {
+			key = string(bytes)
+		}
+		name := requests[facet.Int64].Name
+		res.Counts[name] = append(res.Counts[name], countFor{key, int(count.Int64), rate})
+	}
+	err = rows.Err()
+	if err != nil {
+		return res, err
+	}
+	sort.Sort(byPosition{res.Rows, positions})
+	for _, request := range requests {
+		res.Counts[request.Name] = sortCounts(res.Counts[request.Name], request.Top)
+	}
+	return res, nil
+}
+
+// byPosition sorts IDs by their position in the order asked for
+type byPosition struct {
+	ids       []int
+	positions []int64
+}
+
+func (p byPosition) Len() int {
+	return len(p.ids)
+}
+
+func (p byPosition) Less(i, j int) bool {
+	return p.positions[i] < p.positions[j]
+}
+
+func (p byPosition) Swap(i, j int) {
+	p.ids[i], p.ids[j] = p.ids[j], p.ids[i]
+	p.positions[i], p.positions[j] = p.positions[j], p.positions[i]
+}
+
+// sortCounts orders counts by key, or keeps the top counts
+// ordered by count then key if top is above zero
+func sortCounts(counts []countFor, top int) []countFor {
+	sort.Slice(counts, func(i, j int) bool {
+		if top > 0 && counts[i].Count != counts[j].Count {
+			return counts[i].Count > counts[j].Count
+		}
+		return keyLess(counts[i].Key, counts[j].Key)
+	})
+	if top > 0 && len(counts) > top {
+		counts = counts[:top]
+	}
+	return counts
+}
+
+// keyLess compares keys of the same facet, which are all
+// integers, all floats or all strings
+func keyLess(a, b interface{}) bool {
+	switch a := a.(type) {
+	case int64:
+		return a < b.(int64)
+	case float64:
+		return a < b.(float64)
+	case string:
+		return a < b.(string)
+	}
+	return false
 }
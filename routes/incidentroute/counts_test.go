@@ -0,0 +1,77 @@
+package incidentroute
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/tim-harding/fatal-encounters-server/query"
+)
+
+func TestCountQuery(t *testing.T) {
+	where := query.NewWhereClause(query.CombinatorAnd)
+	where.AddClause(query.NewInClause("state_id", []int{5}))
+	order := query.NewKeysetOrderClause(query.OrderingAscending, []string{"incident.id"})
+	requests := []facetRequest{{Name: "race"}, {Name: "gender"}}
+	q := countQuery(where, order, requests, &nationalPlace)
+	const wanted = "WITH filtered AS ( SELECT incident.id, ROW_NUMBER() OVER (ORDER BY incident.id ASC NULLS LAST) AS position, " +
+		"incident.race_id AS facet0, CASE incident.is_male WHEN TRUE THEN 'male' WHEN FALSE THEN 'female' END AS facet1 " +
+		"FROM incident WHERE (state_id IN ($1)) ) " +
+		"SELECT id, position, NULL, NULL, NULL, NULL, NULL FROM filtered " +
+		"UNION ALL SELECT NULL, NULL, CASE WHEN GROUPING(facet0) = 0 THEN 0 WHEN GROUPING(facet1) = 0 THEN 1 END, COUNT(1), " +
+		"CASE WHEN GROUPING(facet0) = 0 THEN COUNT(1) * 100000.0 / population_for(NULL, NULL, NULL, facet0) " +
+		"WHEN GROUPING(facet1) = 0 THEN NULL::NUMERIC END, facet0, facet1 " +
+		"FROM filtered GROUP BY GROUPING SETS ((facet0), (facet1))"
+	if was := normalizeSpace(q.String()); was != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", was, wanted)
+	}
+}
+
+func TestQueryCountRows(t *testing.T) {
+	h, mock := newHandler(t)
+	requests := []facetRequest{{Name: "race"}, {Name: "agency", Top: 1}}
+	q := query.NewRawSQL("SELECT counts")
+	mock.ExpectQuery("SELECT counts").WillReturnRows(
+		sqlmock.NewRows([]string{"id", "position", "facet", "count", "rate", "facet0", "facet1"}).
+			AddRow(nil, nil, 0, 2, nil, 3, nil).
+			AddRow(nil, nil, 0, 1, nil, nil, nil).
+			AddRow(7, 2, nil, nil, nil, nil, nil).
+			AddRow(nil, nil, 0, 1, nil, 1, nil).
+			AddRow(9, 1, nil, nil, nil, nil, nil).
+			AddRow(nil, nil, 1, 1, nil, nil, 4).
+			AddRow(nil, nil, 1, 2, nil, nil, 6))
+
+	res, err := h.queryCountRows(context.Background(), q, requests)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wanted := countsResponse{
+		Counts: map[string][]countFor{
+			"race":   {{int64(1), 1, nil}, {int64(3), 2, nil}},
+			"agency": {{int64(6), 2, nil}},
+		},
+		Rows: []int{9, 7},
+	}
+	if !reflect.DeepEqual(res, wanted) {
+		t.Errorf("Was `%v`;\nWant `%v`", res, wanted)
+	}
+}
+
+func TestCountQueryByAgency(t *testing.T) {
+	where := query.NewWhereClause(query.CombinatorAnd)
+	where.AddClause(query.NewInClause("incident.race_id", []int{2}))
+	order := query.NewKeysetOrderClause(query.OrderingAscending, []string{"incident.id"})
+	q := countQuery(where, order, []facetRequest{{Name: "agency"}, {Name: "year"}}, nil)
+	// Incidents count toward each agency involved, and once toward everything else
+	const wanted = "WITH filtered AS ( SELECT incident.id, ROW_NUMBER() OVER (ORDER BY incident.id ASC NULLS LAST) AS position, " +
+		"incident_agency.agency_id AS facet0, EXTRACT(YEAR FROM incident.date)::INTEGER AS facet1 " +
+		"FROM incident " +
+		"LEFT JOIN incident_agency ON incident_agency.incident_id = incident.id WHERE (incident.race_id IN ($1)) ) " +
+		"SELECT id, MIN(position), NULL, NULL, NULL, NULL, NULL FROM filtered GROUP BY id " +
+		"UNION ALL SELECT NULL, NULL, CASE WHEN GROUPING(facet0) = 0 THEN 0 WHEN GROUPING(facet1) = 0 THEN 1 END, " +
+		"COUNT(DISTINCT id), NULL::NUMERIC, facet0, facet1 FROM filtered GROUP BY GROUPING SETS ((facet0), (facet1))"
+	if was := normalizeSpace(q.String()); was != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", was, wanted)
+	}
+}
@@ -0,0 +1,218 @@
+package incidentroute
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+const (
+	defaultCrosstabRows = "race"
+	defaultCrosstabCols = "cause"
+)
+
+// crosstabCell is one row of the crosstab query. Grouping has bit 2 set
+// when the row key is rolled up and bit 1 when the column key is.
+type crosstabCell struct {
+	Row      interface{}
+	Col      interface{}
+	Count    int
+	Grouping int
+}
+
+type crosstabResponse struct {
+	Rows    string        `json:"rows"`
+	Cols    string        `json:"cols"`
+	RowKeys []interface{} `json:"rowKeys"`
+	ColKeys []interface{} `json:"colKeys"`
+	// Counts holds a row for each of RowKeys with a count for each of ColKeys
+	Counts    [][]int `json:"counts"`
+	RowTotals []int   `json:"rowTotals"`
+	ColTotals []int   `json:"colTotals"`
+	Total     int     `json:"total"`
+}
+
+// HandleIncidentCrosstabRoute handles requests to /incident/crosstab
+func (h *Handler) HandleIncidentCrosstabRoute(w http.ResponseWriter, r *http.Request) {
+	q := populateFiltered(whereClauseFilter(r))
+	rows := pickCrosstabFacet(r, "rows", defaultCrosstabRows)
+	cols := pickCrosstabFacet(r, "cols", defaultCrosstabCols)
+	if !shared.CheckParams(w, r) {
+		return
+	}
+	if rows.Name == cols.Name {
+		shared.FieldErrors(w, []shared.FieldError{{Field: "cols", Message: "expected a different facet than rows"}})
+		return
+	}
+	h.Cached(w, r, q, func(w http.ResponseWriter) bool {
+		return h.writeCrosstab(w, r, q, rows, cols)
+	})
+}
+
+func (h *Handler) writeCrosstab(w http.ResponseWriter, r *http.Request, q query.Clauser, rows, cols facetRequest) bool {
+	ctx := r.Context()
+	tx, err := h.beginFiltered(ctx, q)
+	if err != nil {
+		shared.QueryError(w, r, err)
+		return false
+	}
+	cells, err := queryCrosstab(ctx, crosstabQuery(rows, cols), tx)
+	if err != nil {
+		tx.Rollback()
+		shared.QueryError(w, r, err)
+		return false
+	}
+	err = tx.Commit()
+	if err != nil {
+		shared.QueryError(w, r, err)
+		return false
+	}
+	return writeJSON(w, newCrosstab(rows.Name, cols.Name, cells))
+}
+
+// beginFiltered starts a transaction holding the IDs of
+// the filtered incidents in the temporary filtered table
+func (h *Handler) beginFiltered(ctx context.Context, populate query.Clauser) (*sql.Tx, error) {
+	tx, err := h.Store.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, statement := range []query.Clauser{query.NewRawSQL(sqlDropTemp), query.NewRawSQL(sqlCreateTemp), populate} {
+		_, err = tx.ExecContext(ctx, statement.String(), statement.Parameters()...)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+// populateFiltered inserts the IDs of the incidents matching where
+func populateFiltered(where query.Clauser) query.Clauser {
+	q := query.NewQuery()
+	q.AddClause(query.NewInsertClause("filtered"))
+	q.AddClause(query.NewSelectClause("incident", []string{"incident.id"}))
+	q.AddClause(where)
+	return q
+}
+
+// pickCrosstabFacet reads a facet for one side of the table,
+// which may be bucketed by width but not limited by top
+func pickCrosstabFacet(r *http.Request, key, defaultName string) facetRequest {
+	querystrings, ok := r.URL.Query()[key]
+	if !ok {
+		return facetRequest{Name: defaultName}
+	}
+	request, err := parseFacet(querystrings[0])
+	if err == nil && request.Top > 0 {
+		err = fmt.Errorf("top is not supported for %s", key)
+	}
+	if err != nil {
+		shared.InvalidParam(r, key, err.Error())
+		return facetRequest{Name: defaultName}
+	}
+	return request
+}
+
+// crosstabQuery counts the filtered incidents for each pair of keys,
+// each key on its own and overall, leaving out incidents missing either key
+func crosstabQuery(rows, cols facetRequest) query.Clauser {
+	rowFacet := facets[rows.Name]
+	colFacet := facets[cols.Name]
+	rowKey := facetKey(rows)
+	colKey := facetKey(cols)
+	grouping := fmt.Sprintf("GROUPING(%s, %s)", rowKey, colKey)
+	// Linked keys give several rows per incident, counted once in the margins
+	count := "COUNT(1)"
+	if rowFacet.Link != "" || colFacet.Link != "" {
+		count = "COUNT(DISTINCT incident.id)"
+	}
+	q := query.NewQuery()
+	q.AddClause(query.NewSelectClause("incident", []string{rowKey, colKey, count, grouping}))
+	// Only agency has a link, and both sides can't be agency
+	for _, link := range []string{rowFacet.Link, colFacet.Link} {
+		if link != "" {
+			q.AddClause(query.NewRawSQL(link))
+		}
+	}
+	q.AddClause(query.NewRawSQL(fmt.Sprintf(sqlFiltered, rowFacet.Column)))
+	q.AddClause(query.NewRawSQL(fmt.Sprintf("AND %s IS NOT NULL", colFacet.Column)))
+	q.AddClause(query.NewRawSQL(fmt.Sprintf("GROUP BY GROUPING SETS ((%[1]s, %[2]s), (%[1]s), (%[2]s), ())", rowKey, colKey)))
+	q.AddClause(query.NewRawSQL("ORDER BY 1, 2"))
+	return q
+}
+
+func queryCrosstab(ctx context.Context, query query.Clauser, tx *sql.Tx) ([]crosstabCell, error) {
+	str := query.String()
+	log.Printf(str)
+	rows, err := tx.QueryContext(ctx, str, query.Parameters()...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []crosstabCell{}
+	for rows.Next() {
+		cell := crosstabCell{}
+		err := rows.Scan(&cell.Row, &cell.Col, &cell.Count, &cell.Grouping)
+		if err != nil {
+			return nil, err
+		}
+		if bytes, ok := cell.Row.([]byte); ok {
+			cell.Row = string(bytes)
+		}
+		if bytes, ok := cell.Col.([]byte); ok {
+			cell.Col = string(bytes)
+		}
+		out = append(out, cell)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// newCrosstab arranges the cells into a matrix. The keys are taken
+// from the margins in the order the query gives them, and pairs
+// without incidents are counted as zero.
+func newCrosstab(rows, cols string, cells []crosstabCell) crosstabResponse {
+	res := crosstabResponse{
+		Rows:      rows,
+		Cols:      cols,
+		RowKeys:   []interface{}{},
+		ColKeys:   []interface{}{},
+		Counts:    [][]int{},
+		RowTotals: []int{},
+		ColTotals: []int{},
+	}
+	rowIndex := map[interface{}]int{}
+	colIndex := map[interface{}]int{}
+	for _, cell := range cells {
+		switch cell.Grouping {
+		case 1:
+			rowIndex[cell.Row] = len(res.RowKeys)
+			res.RowKeys = append(res.RowKeys, cell.Row)
+			res.RowTotals = append(res.RowTotals, cell.Count)
+		case 2:
+			colIndex[cell.Col] = len(res.ColKeys)
+			res.ColKeys = append(res.ColKeys, cell.Col)
+			res.ColTotals = append(res.ColTotals, cell.Count)
+		case 3:
+			res.Total = cell.Count
+		}
+	}
+	for range res.RowKeys {
+		res.Counts = append(res.Counts, make([]int, len(res.ColKeys)))
+	}
+	for _, cell := range cells {
+		if cell.Grouping == 0 {
+			res.Counts[rowIndex[cell.Row]][colIndex[cell.Col]] = cell.Count
+		}
+	}
+	return res
+}
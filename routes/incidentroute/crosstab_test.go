@@ -0,0 +1,77 @@
+package incidentroute
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestCrosstabQuery(t *testing.T) {
+	q := crosstabQuery(facetRequest{Name: "state"}, facetRequest{Name: "age", Width: 10})
+	const wanted = "SELECT incident.state_id, incident.age / 10 * 10, COUNT(1), GROUPING(incident.state_id, incident.age / 10 * 10) " +
+		"FROM incident " +
+		"WHERE incident.id IN ( SELECT filtered.id FROM filtered ) AND incident.state_id IS NOT NULL AND incident.age IS NOT NULL " +
+		"GROUP BY GROUPING SETS ((incident.state_id, incident.age / 10 * 10), (incident.state_id), (incident.age / 10 * 10), ()) " +
+		"ORDER BY 1, 2"
+	if was := normalizeSpace(q.String()); was != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", was, wanted)
+	}
+}
+
+func TestNewCrosstab(t *testing.T) {
+	cells := []crosstabCell{
+		{int64(1), int64(3), 2, 0},
+		{int64(1), nil, 2, 1},
+		{int64(2), int64(4), 5, 0},
+		{int64(2), nil, 5, 1},
+		{nil, int64(3), 2, 2},
+		{nil, int64(4), 5, 2},
+		{nil, nil, 7, 3},
+	}
+	wanted := crosstabResponse{
+		Rows:      "race",
+		Cols:      "cause",
+		RowKeys:   []interface{}{int64(1), int64(2)},
+		ColKeys:   []interface{}{int64(3), int64(4)},
+		Counts:    [][]int{{2, 0}, {0, 5}},
+		RowTotals: []int{2, 5},
+		ColTotals: []int{2, 5},
+		Total:     7,
+	}
+	if was := newCrosstab("race", "cause", cells); !reflect.DeepEqual(was, wanted) {
+		t.Errorf("Was `%v`;\nWant `%v`", was, wanted)
+	}
+}
+
+func TestCrosstabRejectsTop(t *testing.T) {
+	r := httptest.NewRequest("GET", "/incident/crosstab?rows=agency:top=5", nil)
+	if was := pickCrosstabFacet(r, "rows", "race"); was.Name != "race" {
+		t.Errorf("Was `%s`;\nWant `race`", was.Name)
+	}
+}
+
+func TestCrosstabReportsFailedCommit(t *testing.T) {
+	h, mock := newHandler(t)
+	r := httptest.NewRequest("GET", "/incident/crosstab", nil)
+	mock.ExpectBegin()
+	mock.ExpectExec(sqlDropTemp).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(sqlCreateTemp).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(populateFiltered(whereClauseFilter(r)).String()).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectQuery(crosstabQuery(facetRequest{Name: "race"}, facetRequest{Name: "cause"}).String()).
+		WillReturnRows(sqlmock.NewRows([]string{"row", "col", "count", "grouping"}).AddRow(nil, nil, 2, 3))
+	mock.ExpectCommit().WillReturnError(errors.New("connection reset"))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentCrosstabRoute(w, r)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Was %d;\nWant %d", w.Code, http.StatusInternalServerError)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,168 @@
+package incidentroute
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+// filterCursor is the position of a row in the order of /incident/filter
+type filterCursor struct {
+	Order     orderKind      `json:"o"`
+	Direction query.Ordering `json:"d"`
+	// Value is the order column, unless ordering by id
+	Value interface{} `json:"v"`
+	ID    int         `json:"id"`
+}
+
+// filterPage tracks keyset pagination of /incident/filter
+type filterPage struct {
+	// limit is the page size, or zero for every row
+	limit     int
+	kind      orderKind
+	direction query.Ordering
+	// after is the cursor the page starts from, if any
+	after *filterCursor
+	// last is the position of the last row scanned
+	last  filterCursor
+	count int
+}
+
+// pickFilterPage reads the count and cursor parameters
+func pickFilterPage(r *http.Request) *filterPage {
+	page := &filterPage{
+		kind:      pickOrderKind(r),
+		direction: pickOrderDirection(r),
+	}
+	if ok, limit := shared.MaybeQueryInt(r, "count"); ok && limit > 0 {
+		page.limit = limit
+	}
+	after := filterCursor{}
+	if shared.DecodeCursor(r, &after) {
+		if after.Order != page.kind || after.Direction != page.direction {
+			shared.InvalidParam(r, "cursor", "cursor was made for a different order")
+		} else if value, err := cursorValue(page.kind, after.Value); err != nil {
+			shared.InvalidParam(r, "cursor", "expected a nextCursor from a previous response")
+		} else {
+			after.Value = value
+			page.after = &after
+		}
+	}
+	_, explicit := r.URL.Query()["order"]
+	if fullTextTerm(r) != "" && !explicit && (page.limit > 0 || page.after != nil) {
+		shared.InvalidParam(r, "count", "paging q results requires an order")
+		page.limit = 0
+		page.after = nil
+	}
+	return page
+}
+
+// cursorValue converts a value decoded from JSON to the type of the order column
+func cursorValue(kind orderKind, value interface{}) (interface{}, error) {
+	if value == nil {
+		return nil, nil
+	}
+	switch kind {
+	case orderKindAge:
+		if age, ok := value.(float64); ok {
+			return int(age), nil
+		}
+	case orderKindName:
+		if name, ok := value.(string); ok {
+			return name, nil
+		}
+	case orderKindDate:
+		if date, ok := value.(string); ok {
+			return time.Parse(isoDateLayout, date)
+		}
+	}
+	return nil, fmt.Errorf("unexpected cursor value %v", value)
+}
+
+// keysetColumns lists the columns rows are sorted by for an order kind
+func keysetColumns(kind orderKind) []string {
+	columns := []string{"incident.id"}
+	if kind != orderKindID {
+		column := fmt.Sprintf("incident.%s", orderKindColumns[kind])
+		columns = append([]string{column}, columns...)
+	}
+	return columns
+}
+
+// valueColumn is the extra column needed to make a cursor, if any
+func (p *filterPage) valueColumn() string {
+	if p.limit < 1 || p.kind == orderKindID {
+		return ""
+	}
+	return fmt.Sprintf("incident.%s", orderKindColumns[p.kind])
+}
+
+// keysetClause selects the rows after the cursor
+func (p *filterPage) keysetClause() query.Clauser {
+	if p.after == nil {
+		return nil
+	}
+	values := []interface{}{p.after.ID}
+	if p.kind != orderKindID {
+		values = []interface{}{p.after.Value, p.after.ID}
+	}
+	return query.NewKeysetClause(p.direction, keysetColumns(p.kind), values)
+}
+
+func (p *filterPage) limitClause() query.Clauser {
+	return query.NewPageClause(p.limit, 0)
+}
+
+// valueTarget is a scan destination for valueColumn
+func (p *filterPage) valueTarget() interface{} {
+	switch p.kind {
+	case orderKindAge:
+		return new(*int)
+	case orderKindName:
+		return new(*string)
+	case orderKindDate:
+		return new(time.Time)
+	}
+	return nil
+}
+
+// scanned records the position of a row once it has been read
+func (p *filterPage) scanned(id int, target interface{}) {
+	p.count++
+	p.last = filterCursor{p.kind, p.direction, nil, id}
+	switch value := target.(type) {
+	case **int:
+		if *value != nil {
+			p.last.Value = **value
+		}
+	case **string:
+		if *value != nil {
+			p.last.Value = **value
+		}
+	case *time.Time:
+		p.last.Value = value.Format(isoDateLayout)
+	}
+}
+
+// trailer sets nextCursor once a full page has been sent,
+// or null when the rows ran out
+func (p *filterPage) trailer() map[string]interface{} {
+	var next *string
+	if p.count == p.limit {
+		cursor := shared.EncodeCursor(p.last)
+		next = &cursor
+	}
+	return map[string]interface{}{"nextCursor": next}
+}
+
+// envelope adds nextCursor to paged responses
+func (p *filterPage) envelope() shared.Envelope {
+	envelope := shared.RowsEnvelope
+	if p.limit > 0 {
+		envelope.Trailer = p.trailer
+	}
+	return envelope
+}
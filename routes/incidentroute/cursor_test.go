@@ -0,0 +1,49 @@
+package incidentroute
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestFilterPages(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT incident.id, incident.age FROM incident " +
+		"ORDER BY incident.age DESC NULLS LAST, incident.id DESC NULLS LAST LIMIT $1").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "age"}).AddRow(8, 40).AddRow(3, nil))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentFilterRoute(w, httptest.NewRequest("GET", "/incident/filter?order=age&orderDirection=descending&count=2", nil))
+
+	res := struct {
+		Rows       []int  `json:"rows"`
+		NextCursor string `json:"nextCursor"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 2 || res.NextCursor == "" {
+		t.Fatalf("Was `%s`;\nWant two rows and a nextCursor", w.Body.String())
+	}
+
+	mock.ExpectQuery("SELECT incident.id, incident.age FROM incident "+
+		"WHERE (((incident.age IS NULL AND (incident.id < $1 OR incident.id IS NULL)))) "+
+		"ORDER BY incident.age DESC NULLS LAST, incident.id DESC NULLS LAST LIMIT $2").
+		WithArgs(3, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "age"}).AddRow(1, nil))
+
+	w = httptest.NewRecorder()
+	h.HandleIncidentFilterRoute(w, httptest.NewRequest("GET", "/incident/filter?order=age&orderDirection=descending&count=2&cursor="+url.QueryEscape(res.NextCursor), nil))
+
+	const wanted = `{"rows":[1],"nextCursor":null}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
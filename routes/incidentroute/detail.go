@@ -2,11 +2,11 @@ package incidentroute
 
 import (
 	"database/sql"
+	"encoding/json"
 	"net/http"
 	"time"
 
 	"github.com/tim-harding/fatal-encounters-server/query"
-	"github.com/tim-harding/fatal-encounters-server/shared"
 )
 
 type enum struct {
@@ -37,33 +37,54 @@ type detailRow struct {
 	County      *enum     `json:"county"`
 	Agency      *enum     `json:"agency"`
 	City        *enum     `json:"city"`
+	// Agencies are all those involved, Agency being the one responsible
+	Agencies []enum  `json:"agencies"`
+	Headline *string `json:"headline,omitempty"`
 }
 
 // HandleIncidentDetailRoute responds to /incident/{id} routes
-func HandleIncidentDetailRoute(w http.ResponseWriter, r *http.Request) {
-	shared.HandleIDRoute(w, r, buildDetailQuery(r), translateDetailRow, "incident")
+func (h *Handler) HandleIncidentDetailRoute(w http.ResponseWriter, r *http.Request) {
+	if term := headlineTerm(r); term != "" {
+		query := buildDetailQuery(selectHeadlineClause(rowKindDetail, term))
+		h.HandleIDRoute(w, r, query, translateDetailHeadlineRow, "incident")
+		return
+	}
+	h.HandleIDRoute(w, r, buildDetailQuery(selectClause(rowKindDetail)), translateDetailRow, "incident")
 }
 
-func buildDetailQuery(r *http.Request) query.Clauser {
+func buildDetailQuery(selectClause query.Clauser) query.Clauser {
 	q := query.NewSubexpression(" ")
-	q.AddClause(selectClause(rowKindDetail))
+	q.AddClause(selectClause)
 	q.AddClause(joinClausesDetail())
 	return q
 }
 
+// joinClausesDetail left joins the enumerations
+// so incidents missing any of them are kept
 func joinClausesDetail() query.Clauser {
 	expr := query.NewSubexpression(" ")
 	for _, table := range enumTables {
-		clause := query.NewJoinClause(table)
+		clause := query.NewLeftJoinClause(table)
 		expr.AddClause(clause)
 	}
 	return expr
 }
 
 func translateDetailRow(rows *sql.Rows) (interface{}, error) {
+	return scanDetailRow(rows, false)
+}
+
+func translateDetailHeadlineRow(rows *sql.Rows) (interface{}, error) {
+	return scanDetailRow(rows, true)
+}
+
+// scanDetailRow reads the rowKindDetail columns,
+// followed by the headline column if selected
+func scanDetailRow(rows *sql.Rows, headline bool) (interface{}, error) {
 	row := detailRow{}
 
 	enums := make([]maybeEnum, 4)
+	var agencies []byte
 	targets := []**enum{
 		&row.Race,
 		&row.County,
@@ -71,7 +92,7 @@ func translateDetailRow(rows *sql.Rows) (interface{}, error) {
 		&row.City,
 	}
 
-	err := rows.Scan(
+	columns := []interface{}{
 		&row.ID,
 		&row.Name,
 		&row.Age,
@@ -101,8 +122,18 @@ func translateDetailRow(rows *sql.Rows) (interface{}, error) {
 
 		&enums[3].ID,
 		&enums[3].Name,
-	)
 
+		&agencies,
+	}
+	if headline {
+		columns = append(columns, &row.Headline)
+	}
+
+	err := rows.Scan(columns...)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(agencies, &row.Agencies)
 	if err != nil {
 		return nil, err
 	}
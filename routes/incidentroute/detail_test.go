@@ -0,0 +1,63 @@
+package incidentroute
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi"
+)
+
+func detailRequest(id, querystring string) *http.Request {
+	r := httptest.NewRequest("GET", "/incident/detail/"+id+querystring, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestDetailHeadline(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT incident.id, incident.name, incident.age, incident.date, incident.image_url, "+
+		"incident.is_male, incident.address, incident.description, incident.article_url, incident.video_url, "+
+		"incident.zipcode, cause.id, cause.name, use_of_force.id, use_of_force.name, race.id, race.name, "+
+		"county.id, county.name, agency.id, agency.name, city.id, city.name, "+
+		"COALESCE((SELECT json_agg(json_build_object('id', agency.id, 'name', agency.name) ORDER BY agency.name) "+
+		"FROM incident_agency JOIN agency ON agency_id=agency.id WHERE incident_id=incident.id), '[]'), "+
+		headlineSQL+" FROM incident "+
+		"LEFT JOIN agency ON agency_id=agency.id LEFT JOIN cause ON cause_id=cause.id "+
+		"LEFT JOIN city ON city_id=city.id LEFT JOIN county ON county_id=county.id "+
+		"LEFT JOIN race ON race_id=race.id LEFT JOIN use_of_force ON use_of_force_id=use_of_force.id "+
+		"WHERE (incident.id IN ($2))").
+		WithArgs("taser", 3).
+		WillReturnRows(sqlmock.NewRows([]string{
+			"id", "name", "age", "date", "image_url", "is_male", "address", "description",
+			"article_url", "video_url", "zipcode", "cause_id", "cause", "use_of_force_id", "use_of_force",
+			"race_id", "race", "county_id", "county", "agency_id", "agency", "city_id", "city",
+			"agencies", "headline",
+		}).AddRow(
+			3, "John Doe", 30, time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC), nil, true, nil, "Hit with a taser",
+			nil, nil, nil, 1, "Taser", 2, "Deadly force",
+			nil, nil, nil, nil, nil, nil, nil, nil,
+			[]byte("[]"), "Hit with a <mark>taser</mark>",
+		))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentDetailRoute(w, detailRequest("3", "?q=taser&headline=true"))
+
+	res := struct {
+		Rows []detailRow `json:"rows"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 1 || res.Rows[0].Headline == nil || *res.Rows[0].Headline != "Hit with a <mark>taser</mark>" {
+		t.Errorf("Was `%s`;\nWant incident 3 with its headline", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,271 @@
+package incidentroute
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+type exportFormat int
+
+const (
+	exportFormatCSV exportFormat = iota
+	exportFormatNDJSON
+)
+
+var querystringToExportFormat = map[string]exportFormat{
+	"csv":    exportFormatCSV,
+	"ndjson": exportFormatNDJSON,
+}
+
+var (
+	exportContentTypes = [...]string{
+		"text/csv",
+		"application/x-ndjson",
+	}
+
+	exportFilenames = [...]string{
+		"incidents.csv",
+		"incidents.ndjson",
+	}
+)
+
+// exportHeader names the CSV columns written by exportRecord.
+// Agencies are the names of all those involved, separated by semicolons.
+var exportHeader = []string{
+	"id",
+	"name",
+	"age",
+	"date",
+	"imageUrl",
+	"isMale",
+	"address",
+	"description",
+	"articleUrl",
+	"videoUrl",
+	"zipcode",
+	"causeId",
+	"cause",
+	"useOfForceId",
+	"useOfForce",
+	"raceId",
+	"race",
+	"countyId",
+	"county",
+	"agencyId",
+	"agency",
+	"cityId",
+	"city",
+	"agencies",
+}
+
+// exportFlushRows is how many rows are written between flushes
+const exportFlushRows = 100
+
+// rowWriter writes one incident of an export, or the error
+// that ends it early
+type rowWriter interface {
+	Write(row detailRow) error
+	Error(res *shared.ErrorResponse) error
+	Flush() error
+}
+
+// HandleIncidentExportRoute streams every incident matching the filters
+// as CSV or newline-delimited JSON
+func (h *Handler) HandleIncidentExportRoute(w http.ResponseWriter, r *http.Request) {
+	format := pickExportFormat(r)
+	q := buildExportQuery(r)
+	if !shared.CheckParams(w, r) {
+		return
+	}
+	rows, err := h.QueryRows(r.Context(), q)
+	if err != nil {
+		shared.QueryError(w, r, err)
+		return
+	}
+	defer rows.Close()
+
+	w.Header().Set("Content-Type", exportContentTypes[format])
+	w.Header().Set("Content-Disposition", `attachment; filename="`+exportFilenames[format]+`"`)
+	writer := newRowWriter(w, format)
+	flusher, _ := w.(http.Flusher)
+	for count := 1; rows.Next(); count++ {
+		row, err := scanDetailRow(rows, false)
+		if err != nil {
+			exportError(r, writer, err)
+			return
+		}
+		err = writer.Write(row.(detailRow))
+		if err != nil {
+			// The client is gone, so there is no one to tell
+			log.Printf("Export interrupted: %v", err)
+			return
+		}
+		if count%exportFlushRows == 0 && flusher != nil {
+			err = writer.Flush()
+			if err != nil {
+				log.Printf("Export interrupted: %v", err)
+				return
+			}
+			flusher.Flush()
+		}
+	}
+	if err := rows.Err(); err != nil {
+		exportError(r, writer, err)
+		return
+	}
+	err = writer.Flush()
+	if err != nil {
+		log.Printf("Export interrupted: %v", err)
+	}
+}
+
+// exportError ends an export that failed after the status was sent with a
+// last record holding the error, so the file can't pass for complete
+func exportError(r *http.Request, writer rowWriter, err error) {
+	res := shared.StreamError(r, err)
+	if res == nil {
+		return
+	}
+	err = writer.Error(res)
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err != nil {
+		log.Printf("Export interrupted: %v", err)
+	}
+}
+
+func pickExportFormat(r *http.Request) exportFormat {
+	querystrings, ok := r.URL.Query()["format"]
+	if !ok {
+		return exportFormatCSV
+	}
+	format, ok := querystringToExportFormat[querystrings[0]]
+	if !ok {
+		shared.InvalidParam(r, "format", "expected csv or ndjson")
+		return exportFormatCSV
+	}
+	return format
+}
+
+func buildExportQuery(r *http.Request) query.Clauser {
+	q := query.NewQuery()
+	q.AddClause(selectClause(rowKindDetail))
+	// Left joins keep incidents with missing enumerations
+	for _, table := range enumTables {
+		q.AddClause(query.NewLeftJoinClause(table))
+	}
+	q.AddClause(whereClauseFilter(r))
+	q.AddClause(orderClause(r))
+	return q
+}
+
+func newRowWriter(w http.ResponseWriter, format exportFormat) rowWriter {
+	switch format {
+	case exportFormatNDJSON:
+		return ndjsonWriter{json.NewEncoder(w)}
+	default:
+		writer := csv.NewWriter(w)
+		// Buffered, so errors surface on the first flush
+		writer.Write(exportHeader)
+		return csvWriter{writer}
+	}
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (n ndjsonWriter) Write(row detailRow) error {
+	return n.encoder.Encode(row)
+}
+
+// Error writes a line holding only an error field, like a cut short envelope
+func (n ndjsonWriter) Error(res *shared.ErrorResponse) error {
+	return n.encoder.Encode(map[string]*shared.ErrorResponse{"error": res})
+}
+
+func (n ndjsonWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+}
+
+func (c csvWriter) Write(row detailRow) error {
+	return c.writer.Write(exportRecord(row))
+}
+
+// Error writes a record of the word error, the code and the message, whose
+// length differs from the header so that CSV readers reject the file
+func (c csvWriter) Error(res *shared.ErrorResponse) error {
+	return c.writer.Write([]string{"error", strconv.Itoa(res.Code), res.Message})
+}
+
+func (c csvWriter) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+// exportRecord formats a row in the order of exportHeader,
+// with empty fields for NULL values
+func exportRecord(row detailRow) []string {
+	record := []string{
+		strconv.Itoa(row.ID),
+		optionalString(row.Name),
+		optionalInt(row.Age),
+		row.Date.Format(isoDateLayout),
+		optionalString(row.ImageURL),
+		optionalBool(row.IsMale),
+		optionalString(row.Address),
+		row.Description,
+		optionalString(row.ArticleURL),
+		optionalString(row.VideoURL),
+		optionalInt(row.Zipcode),
+		strconv.Itoa(row.Cause.ID),
+		row.Cause.Name,
+		strconv.Itoa(row.UseOfForce.ID),
+		row.UseOfForce.Name,
+	}
+	for _, e := range []*enum{row.Race, row.County, row.Agency, row.City} {
+		if e == nil {
+			record = append(record, "", "")
+		} else {
+			record = append(record, strconv.Itoa(e.ID), e.Name)
+		}
+	}
+	names := []string{}
+	for _, agency := range row.Agencies {
+		names = append(names, agency.Name)
+	}
+	return append(record, strings.Join(names, "; "))
+}
+
+func optionalString(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func optionalInt(i *int) string {
+	if i == nil {
+		return ""
+	}
+	return strconv.Itoa(*i)
+}
+
+func optionalBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
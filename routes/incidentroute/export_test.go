@@ -0,0 +1,92 @@
+package incidentroute
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+const exportSelect = "SELECT incident.id, incident.name, incident.age, incident.date, incident.image_url, " +
+	"incident.is_male, incident.address, incident.description, incident.article_url, incident.video_url, " +
+	"incident.zipcode, cause.id, cause.name, use_of_force.id, use_of_force.name, race.id, race.name, " +
+	"county.id, county.name, agency.id, agency.name, city.id, city.name, " + agenciesColumn + " FROM incident " +
+	"LEFT JOIN agency ON agency_id=agency.id LEFT JOIN cause ON cause_id=cause.id " +
+	"LEFT JOIN city ON city_id=city.id LEFT JOIN county ON county_id=county.id " +
+	"LEFT JOIN race ON race_id=race.id LEFT JOIN use_of_force ON use_of_force_id=use_of_force.id "
+
+func TestExportCSV(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery(exportSelect +
+		"WHERE (age >= $1) ORDER BY incident.id ASC NULLS LAST").
+		WithArgs(30).
+		WillReturnRows(sqlmock.NewRows(rowNames[rowKindDetail]).
+			AddRow(1, "Jane \"JD\" Doe", 31, time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC), nil, false, nil, "Shot, fatally",
+				nil, nil, 97201, 2, "Gunshot", 3, "Deadly force", nil, nil, nil, nil, 4, "Portland Police", 5, "Portland",
+				`[{"id":4,"name":"Portland Police"},{"id":6,"name":"Multnomah County Sheriff"}]`))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentExportRoute(w, httptest.NewRequest("GET", "/incident/export?ageMin=30", nil))
+
+	const wanted = "id,name,age,date,imageUrl,isMale,address,description,articleUrl,videoUrl,zipcode," +
+		"causeId,cause,useOfForceId,useOfForce,raceId,race,countyId,county,agencyId,agency,cityId,city,agencies\n" +
+		`1,"Jane ""JD"" Doe",31,2020-01-31,,false,,"Shot, fatally",,,97201,2,Gunshot,3,Deadly force,,,,,4,Portland Police,5,Portland,Portland Police; Multnomah County Sheriff` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/csv" {
+		t.Errorf("Was `%s`;\nWant `text/csv`", contentType)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExportFiltersByState(t *testing.T) {
+	h, mock := newHandler(t)
+	// city, county and agency all have a state_id
+	mock.ExpectQuery(exportSelect + "WHERE (incident.state_id IN ($1)) ORDER BY incident.id ASC NULLS LAST").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows(rowNames[rowKindDetail]))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentExportRoute(w, httptest.NewRequest("GET", "/incident/export?state_id=5", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Was %d;\nWant %d", w.Code, http.StatusOK)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExportReportsLateErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		wanted string
+	}{
+		{"csv", "error,500,Internal Server Error\n"},
+		{"ndjson", `{"error":{"code":500,"message":"Internal Server Error"}}` + "\n"},
+	}
+	for _, test := range tests {
+		h, mock := newHandler(t)
+		mock.ExpectQuery(exportSelect + "ORDER BY incident.id ASC NULLS LAST").
+			WillReturnRows(sqlmock.NewRows(rowNames[rowKindDetail]).
+				AddRow(1, nil, nil, time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC), nil, nil, nil, "Shot",
+					nil, nil, nil, 2, "Gunshot", 3, "Deadly force", nil, nil, nil, nil, nil, nil, nil, nil, `[]`).
+				AddRow(2, nil, nil, time.Date(2020, 2, 1, 0, 0, 0, 0, time.UTC), nil, nil, nil, "Shot",
+					nil, nil, nil, 2, "Gunshot", 3, "Deadly force", nil, nil, nil, nil, nil, nil, nil, nil, `[]`).
+				RowError(1, errors.New("connection reset")))
+
+		w := httptest.NewRecorder()
+		h.HandleIncidentExportRoute(w, httptest.NewRequest("GET", "/incident/export?format="+test.format, nil))
+
+		if !strings.HasSuffix(w.Body.String(), test.wanted) {
+			t.Errorf("Was `%s`;\nWant it to end with `%s`", w.Body.String(), test.wanted)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package incidentroute
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+// facetRequest is one entry of the facets parameter,
+// such as agency:top=5 or age:width=10
+type facetRequest struct {
+	Name string
+	// Top limits the counts to the most common keys, if above zero
+	Top int
+	// Width groups ages into buckets, if above zero
+	Width int
+}
+
+// pickFacets reads facets=name:option=value:...,name,...
+func pickFacets(r *http.Request) []facetRequest {
+	querystrings, ok := r.URL.Query()["facets"]
+	if !ok {
+		requests := []facetRequest{}
+		for _, name := range defaultFacets {
+			requests = append(requests, facetRequest{Name: name})
+		}
+		return requests
+	}
+	requests := []facetRequest{}
+	seen := map[string]bool{}
+	for _, querystring := range querystrings {
+		for _, entry := range strings.Split(querystring, ",") {
+			request, err := parseFacet(entry)
+			if err == nil && seen[request.Name] {
+				err = fmt.Errorf("%s is repeated", request.Name)
+			}
+			if err != nil {
+				shared.InvalidParam(r, "facets", err.Error())
+				continue
+			}
+			seen[request.Name] = true
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+func parseFacet(entry string) (facetRequest, error) {
+	parts := strings.Split(entry, ":")
+	request := facetRequest{Name: parts[0]}
+	if _, ok := facets[request.Name]; !ok {
+		return request, fmt.Errorf("unknown facet %s", request.Name)
+	}
+	for _, option := range parts[1:] {
+		pair := strings.SplitN(option, "=", 2)
+		if len(pair) != 2 {
+			return request, fmt.Errorf("expected option=value in %s", entry)
+		}
+		value, err := strconv.Atoi(pair[1])
+		if err != nil || value < 1 {
+			return request, fmt.Errorf("expected a positive integer for %s in %s", pair[0], entry)
+		}
+		switch {
+		case pair[0] == "top":
+			request.Top = value
+		case pair[0] == "width" && request.Name == "age":
+			request.Width = value
+		default:
+			return request, fmt.Errorf("unknown option %s in %s", pair[0], entry)
+		}
+	}
+	return request, nil
+}
+
+// unfilteredFacetQuery counts every incident for each key of a facet,
+// reading the count view of the facet if it has one
+func unfilteredFacetQuery(request facetRequest, rate bool) query.Clauser {
+	view, ok := countViews[request.Name]
+	if !ok || request.Width > 0 {
+		return facetQueryWhere(request, rate, sqlNotNull)
+	}
+	columns := []string{"key", "count"}
+	if rate {
+		population, _ := facetPopulation(request, "key", nationalPlace)
+		columns = append(columns, rateColumn("count", "NULL", population))
+	}
+	q := query.NewQuery()
+	q.AddClause(query.NewSelectClause(view, columns))
+	orderTop(q, request)
+	return q
+}
+
+// facetQueryWhere counts the incidents matching where, which
+// holds %s for the facet column
+func facetQueryWhere(request facetRequest, rate bool, where string) query.Clauser {
+	f := facets[request.Name]
+	key := facetKey(request)
+	columns := []string{key, "COUNT(1)"}
+	if rate {
+		// Counts span every year, so rates use the latest population
+		population, _ := facetPopulation(request, f.Column, nationalPlace)
+		columns = append(columns, rateColumn("COUNT(1)", "NULL", population))
+	}
+	q := query.NewQuery()
+	q.AddClause(query.NewSelectClause("incident", columns))
+	if f.Link != "" {
+		q.AddClause(query.NewRawSQL(f.Link))
+	}
+	q.AddClause(query.NewRawSQL(fmt.Sprintf(where, f.Column)))
+	q.AddClause(query.NewGroupClause("1"))
+	orderTop(q, request)
+	return q
+}
+
+// orderTop orders a key and count query by key,
+// or by count then key when limited to the top keys
+func orderTop(q query.Subclauser, request facetRequest) {
+	if request.Top > 0 {
+		q.AddClause(query.NewRawSQL("ORDER BY 2 DESC, 1"))
+		q.AddClause(query.NewPageClause(request.Top, 0))
+	} else {
+		q.AddClause(query.NewRawSQL("ORDER BY 1"))
+	}
+}
+
+// facetKey is the expression a facet groups on
+func facetKey(request facetRequest) string {
+	f := facets[request.Name]
+	if request.Width > 0 {
+		// Integer division rounds down to the start of the bucket
+		return fmt.Sprintf("%s / %d * %d", f.Column, request.Width, request.Width)
+	}
+	return fmt.Sprintf(f.Key, f.Column)
+}
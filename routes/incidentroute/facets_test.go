@@ -0,0 +1,90 @@
+package incidentroute
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPickFacets(t *testing.T) {
+	r := httptest.NewRequest("GET", "/incident/count?facets=race,agency:top=5,age:width=10", nil)
+	wanted := []facetRequest{{"race", 0, 0}, {"agency", 5, 0}, {"age", 0, 10}}
+	if was := pickFacets(r); !reflect.DeepEqual(was, wanted) {
+		t.Errorf("Was `%v`;\nWant `%v`", was, wanted)
+	}
+}
+
+func TestFacetOptionErrors(t *testing.T) {
+	for _, entry := range []string{"nope", "race:width=5", "age:width=0", "agency:top"} {
+		if _, err := parseFacet(entry); err == nil {
+			t.Errorf("Was valid;\nWant error for `%s`", entry)
+		}
+	}
+}
+
+func TestTopFacetQuery(t *testing.T) {
+	q := unfilteredFacetQuery(facetRequest{Name: "city", Top: 3}, false)
+	const wanted = "SELECT incident.city_id, COUNT(1) FROM incident " +
+		"WHERE incident.city_id IS NOT NULL GROUP BY 1 ORDER BY 2 DESC, 1 LIMIT $1"
+	if was := normalizeSpace(q.String()); was != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", was, wanted)
+	}
+}
+
+func TestAgeBucketQuery(t *testing.T) {
+	q := unfilteredFacetQuery(facetRequest{Name: "age", Width: 10}, false)
+	const wanted = "SELECT incident.age / 10 * 10, COUNT(1) FROM incident " +
+		"WHERE incident.age IS NOT NULL GROUP BY 1 ORDER BY 1"
+	if was := normalizeSpace(q.String()); was != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", was, wanted)
+	}
+}
+
+// normalizeSpace collapses the indentation of multiline SQL constants
+func normalizeSpace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func TestRateFacetQuery(t *testing.T) {
+	q := unfilteredFacetQuery(facetRequest{Name: "county"}, true)
+	const wanted = "SELECT incident.county_id, COUNT(1), COUNT(1) * 100000.0 / population_for(NULL, " +
+		"(SELECT county.state_id FROM county WHERE county.id = incident.county_id), incident.county_id, NULL) " +
+		"FROM incident WHERE incident.county_id IS NOT NULL GROUP BY 1 ORDER BY 1"
+	if was := normalizeSpace(q.String()); was != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", was, wanted)
+	}
+}
+
+func TestUnfilteredFacetQuery(t *testing.T) {
+	q := unfilteredFacetQuery(facetRequest{Name: "race", Top: 3}, true)
+	const wanted = "SELECT key, count, count * 100000.0 / population_for(NULL, NULL, NULL, key) " +
+		"FROM count_by_race ORDER BY 2 DESC, 1 LIMIT $1"
+	if was := normalizeSpace(q.String()); was != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", was, wanted)
+	}
+}
+
+func TestCountyRate(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT incident.id FROM incident ORDER BY incident.id ASC NULLS LAST").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	// County populations are loaded with their state
+	mock.ExpectQuery(unfilteredFacetQuery(facetRequest{Name: "county"}, true).String()).
+		WillReturnRows(sqlmock.NewRows([]string{"key", "count", "rate"}).AddRow(3, 2, 0.25))
+	mock.ExpectCommit()
+
+	w := httptest.NewRecorder()
+	h.HandleCountRoute(w, httptest.NewRequest("GET", "/incident/count?facets=county&rate=per100k", nil))
+
+	const wanted = `{"counts":{"county":[{"key":3,"count":2,"rate":0.25}]},"rows":[1,2]}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
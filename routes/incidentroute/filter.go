@@ -1,44 +1,136 @@
 package incidentroute
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/tim-harding/fatal-encounters-server/query"
 	"github.com/tim-harding/fatal-encounters-server/shared"
 )
 
+type filterHeadlineRow struct {
+	ID       int    `json:"id"`
+	Headline string `json:"headline"`
+}
+
+// geoJSONUnsupported are the filter parameters a FeatureCollection has no
+// place for, so GeoJSON responses always hold every matching incident
+var geoJSONUnsupported = []string{"count", "cursor", "includeTotal", "headline"}
+
 // HandleIncidentFilterRoute responds to /incident/{id} routes
-func HandleIncidentFilterRoute(w http.ResponseWriter, r *http.Request) {
-	query := buildFilterQuery(r)
-	shared.HandleRoute(w, r, query, translateFilterRow)
+func (h *Handler) HandleIncidentFilterRoute(w http.ResponseWriter, r *http.Request) {
+	if pickFormat(r) == formatGeoJSON {
+		for _, key := range geoJSONUnsupported {
+			if _, ok := r.URL.Query()[key]; ok {
+				shared.InvalidParam(r, key, "not supported with format=geojson")
+			}
+		}
+		h.handleGeoJSON(w, r, whereClauseFilter(r), orderClause(r))
+		return
+	}
+	term := headlineTerm(r)
+	page := pickFilterPage(r)
+	where := whereClauseFilter(r)
+	envelope := page.envelope()
+	if shared.IncludeTotal(r) {
+		if !shared.CheckParams(w, r) {
+			return
+		}
+		fields, err := h.filterTotals(r.Context(), where, page)
+		if err != nil {
+			shared.QueryError(w, r, err)
+			return
+		}
+		envelope.Fields = fields
+	}
+	query := buildFilterQuery(r, where, term, page)
+	h.HandleEnvelopeRoute(w, r, query, filterTranslator(term != "", page), envelope)
 }
 
-func buildFilterQuery(r *http.Request) query.Clauser {
+func buildFilterQuery(r *http.Request, where query.Subclauser, term string, page *filterPage) query.Clauser {
+	where.AddClause(page.keysetClause())
 	q := query.NewQuery()
-	q.AddClause(selectClause(rowKindFilter))
-	// TODO: Only include join if filtering by state
-	q.AddClause(query.NewJoinClause("city"))
-	q.AddClause(whereClauseFilter(r))
-	q.AddClause(orderClause(r))
+	q.AddClause(selectFilterClause(term, page))
+	q.AddClause(where)
+	q.AddClause(orderClauseFor(r, page.kind, page.direction))
+	q.AddClause(page.limitClause())
 	return q
 }
 
-func whereClauseFilter(r *http.Request) query.Clauser {
+// filterTotals counts every incident matching where, and those after
+// the cursor to tell whether another page follows. Cursors don't carry a
+// page number, so page is how many pages of count fit before the cursor.
+func (h *Handler) filterTotals(ctx context.Context, where query.Clauser, page *filterPage) (map[string]interface{}, error) {
+	counts := []query.Clauser{
+		query.NewCountClause(nil),
+		query.NewCountClause(page.keysetClause()),
+	}
+	q := query.NewQuery()
+	q.AddClause(query.NewSelectExprClause("incident", counts))
+	q.AddClause(where)
+	rows, err := h.QueryRows(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var total, remaining int
+	if rows.Next() {
+		err = rows.Scan(&total, &remaining)
+		if err != nil {
+			return nil, err
+		}
+	}
+	number := 0
+	if page.limit > 0 {
+		number = (total - remaining) / page.limit
+	}
+	fields := map[string]interface{}{
+		"total":   total,
+		"page":    number,
+		"count":   page.limit,
+		"hasMore": page.limit > 0 && remaining > page.limit,
+	}
+	return fields, rows.Err()
+}
+
+// selectFilterClause selects the incident ID, then the headline if there is
+// a search term to highlight, then the order column if it is needed for a cursor
+func selectFilterClause(term string, page *filterPage) query.Clauser {
+	columns := []query.Clauser{}
+	for _, name := range rowNames[rowKindFilter] {
+		columns = append(columns, query.NewRawSQL(name))
+	}
+	if term != "" {
+		columns = append(columns, query.NewHeadlineClause(headlineColumn, term))
+	}
+	if column := page.valueColumn(); column != "" {
+		columns = append(columns, query.NewRawSQL(column))
+	}
+	return query.NewSelectExprClause("incident", columns)
+}
+
+func whereClauseFilter(r *http.Request) query.Subclauser {
 	w := query.NewWhereClause(query.CombinatorAnd)
+	// Qualified since city, county and agency have a state_id too
 	for _, table := range idQueryTables {
-		column := fmt.Sprintf("%s_id", table)
-		clause := shared.InClause(r, column)
-		w.AddClause(clause)
+		key := fmt.Sprintf("%s_id", table)
+		w.AddClause(shared.InClauseFor(r, key, "incident."+key))
 	}
-	w.AddClause(shared.SearchClause(r))
+	// Qualified since joined tables also have a name column
+	w.AddClause(shared.SearchClause(r, "incident.name"))
+	w.AddClause(fullTextClause(r))
 	w.AddClause(ageClause(r, "ageMin", query.ComparisonGreaterEqual))
 	w.AddClause(ageClause(r, "ageMax", query.ComparisonLesserEqual))
 	w.AddClause(genderMaskClause(r))
+	w.AddClause(agencyTypeClause(r))
 	w.AddClause(dateMaskClause(r, "dateMin", query.ComparisonGreaterEqual))
 	w.AddClause(dateMaskClause(r, "dateMax", query.ComparisonLesserEqual))
+	w.AddClause(spatialClauses(r))
 	return w
 }
 
@@ -57,17 +149,87 @@ func genderMaskClause(r *http.Request) query.Clauser {
 	}
 	isMale, ok := genders[querystrings[0]]
 	if !ok {
+		shared.InvalidParam(r, "gender", "expected male or female")
 		return nil
 	}
 	return query.NewCompareClause(query.ComparisonEqual, "is_male", isMale)
 }
 
+// agencyTypeClause matches incidents involving any agency of the given type
+func agencyTypeClause(r *http.Request) query.Clauser {
+	querystrings, ok := r.URL.Query()["agencyType"]
+	if !ok {
+		return nil
+	}
+	if !shared.IsAgencyType(querystrings[0]) {
+		shared.InvalidParam(r, "agencyType", "expected one of "+strings.Join(shared.AgencyTypes, ", "))
+		return nil
+	}
+	where := query.NewWhereClause(query.CombinatorAnd)
+	where.AddClause(query.NewCompareClause(query.ComparisonEqual, "agency.type", querystrings[0]))
+	involved := query.NewSubexpression(" ")
+	involved.AddClause(query.NewSelectClause("incident_agency", []string{"incident_id"}))
+	involved.AddClause(query.NewJoinClause("agency"))
+	involved.AddClause(where)
+	q := query.NewSubexpression(" ")
+	q.AddClause(query.NewRawSQL("incident.id IN"))
+	q.AddClause(query.NewSubquery(involved))
+	return q
+}
+
+// fullTextClause matches the `q` parameter against
+// descriptions, names, addresses, agencies and cities
+func fullTextClause(r *http.Request) query.Clauser {
+	term := fullTextTerm(r)
+	if term == "" {
+		return nil
+	}
+	return query.NewFullTextSearchClause(searchVectorColumn, term)
+}
+
+func fullTextTerm(r *http.Request) string {
+	querystrings, ok := r.URL.Query()["q"]
+	if !ok || len(querystrings) < 1 {
+		return ""
+	}
+	return querystrings[0]
+}
+
+// headlineTerm gets the search term to highlight
+// if headlines were requested for a full text search
+func headlineTerm(r *http.Request) string {
+	querystrings, ok := r.URL.Query()["headline"]
+	if !ok || len(querystrings) < 1 {
+		return ""
+	}
+	headline, err := strconv.ParseBool(querystrings[0])
+	if err != nil {
+		shared.InvalidParam(r, "headline", "expected true or false")
+		return ""
+	}
+	if !headline {
+		return ""
+	}
+	term := fullTextTerm(r)
+	if term == "" {
+		shared.InvalidParam(r, "headline", "requires a q search")
+	}
+	return term
+}
+
 func orderClause(r *http.Request) query.Clauser {
-	kind := pickOrderKind(r)
-	column := orderKindColumns[kind]
-	column = fmt.Sprintf("incident.%s", column)
-	direction := pickOrderDirection(r)
-	return query.NewOrderClause(direction, []string{column})
+	return orderClauseFor(r, pickOrderKind(r), pickOrderDirection(r))
+}
+
+// orderClauseFor sorts by relevance for a full text search without an
+// explicit order, otherwise by the given kind and direction
+func orderClauseFor(r *http.Request, kind orderKind, direction query.Ordering) query.Clauser {
+	_, explicit := r.URL.Query()["order"]
+	if term := fullTextTerm(r); term != "" && !explicit {
+		return query.NewRankOrderClause(searchVectorColumn, term, []string{"incident.id"})
+	}
+	// Sorted by ID within equal values so cursors have a unique position
+	return query.NewKeysetOrderClause(direction, keysetColumns(kind))
 }
 
 func pickOrderKind(r *http.Request) orderKind {
@@ -77,6 +239,7 @@ func pickOrderKind(r *http.Request) orderKind {
 	}
 	order, ok := querystringToOrderKind[querystrings[0]]
 	if !ok {
+		shared.InvalidParam(r, "order", "expected id, age, name or date")
 		return orderKindID
 	}
 	return order
@@ -89,6 +252,7 @@ func pickOrderDirection(r *http.Request) query.Ordering {
 	}
 	orderDirection, ok := querystringToOrderDirection[querystrings[0]]
 	if !ok {
+		shared.InvalidParam(r, "orderDirection", "expected ascending or descending")
 		return query.OrderingAscending
 	}
 	return orderDirection
@@ -99,17 +263,36 @@ func dateMaskClause(r *http.Request, key string, comparator query.Comparison) qu
 	if !ok {
 		return nil
 	}
-	t, err := time.Parse("2006-Jan-02", querystrings[0])
+	t, err := time.Parse(dateLayout, querystrings[0])
 	if err != nil {
+		shared.InvalidParam(r, key, "expected a date like 2020-Jan-31")
 		return nil
 	}
 	return query.NewCompareClause(comparator, "date", t)
 }
 
-func translateFilterRow(rows *sql.Rows) (interface{}, error) {
-	var id int
-	err := rows.Scan(
-		&id,
-	)
-	return id, err
+// filterTranslator reads the columns chosen by selectFilterClause,
+// recording the position of each row in page
+func filterTranslator(headline bool, page *filterPage) shared.RowTranslatorFunc {
+	return func(rows *sql.Rows) (interface{}, error) {
+		row := filterHeadlineRow{}
+		targets := []interface{}{&row.ID}
+		if headline {
+			targets = append(targets, &row.Headline)
+		}
+		var value interface{}
+		if page.valueColumn() != "" {
+			value = page.valueTarget()
+			targets = append(targets, value)
+		}
+		err := rows.Scan(targets...)
+		if err != nil {
+			return nil, err
+		}
+		page.scanned(row.ID, value)
+		if headline {
+			return row, nil
+		}
+		return row.ID, nil
+	}
 }
@@ -0,0 +1,163 @@
+package incidentroute
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+func TestAgencyTypeClause(t *testing.T) {
+	r := httptest.NewRequest("GET", "/incident/filter?agencyType=sheriff", nil)
+	clause := agencyTypeClause(r)
+	const wanted = "incident.id IN (SELECT incident_id FROM incident_agency " +
+		"JOIN agency ON agency_id=agency.id WHERE (agency.type = ?))"
+	if was := normalizeSpace(clause.String()); was != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", was, wanted)
+	}
+	if params := clause.Parameters(); len(params) != 1 || params[0] != "sheriff" {
+		t.Errorf("Unexpected parameters %v", params)
+	}
+}
+
+func TestUnknownAgencyTypeIsIgnored(t *testing.T) {
+	r := httptest.NewRequest("GET", "/incident/filter?agencyType=constable", nil)
+	if clause := agencyTypeClause(r); clause != nil {
+		t.Errorf("Was `%s`;\nWant nil", clause.String())
+	}
+}
+
+func TestFilterKeepsIncidentsWithoutCity(t *testing.T) {
+	h, mock := newHandler(t)
+	// Incident 2 has no city
+	mock.ExpectQuery("SELECT COUNT(1), COUNT(1) FROM incident").
+		WillReturnRows(sqlmock.NewRows([]string{"total", "remaining"}).AddRow(2, 2))
+	mock.ExpectQuery("SELECT incident.id FROM incident " +
+		"ORDER BY incident.id ASC NULLS LAST LIMIT $1").
+		WithArgs(2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentFilterRoute(w, httptest.NewRequest("GET", "/incident/filter?includeTotal=true&count=2", nil))
+
+	res := struct {
+		Rows  []int `json:"rows"`
+		Total int   `json:"total"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 2 || res.Total != 2 {
+		t.Errorf("Was `%s`;\nWant both incidents in the rows and total", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFilterTotalsPage(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT COUNT(1), COUNT(1) FILTER (WHERE (((incident.id > $1 OR incident.id IS NULL)))) FROM incident").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"total", "remaining"}).AddRow(5, 1))
+	mock.ExpectQuery("SELECT incident.id FROM incident WHERE ((((incident.id > $1 OR incident.id IS NULL)))) "+
+		"ORDER BY incident.id ASC NULLS LAST LIMIT $2").
+		WithArgs(4, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
+
+	after := shared.EncodeCursor(filterCursor{Order: orderKindID, Direction: query.OrderingAscending, ID: 4})
+	w := httptest.NewRecorder()
+	h.HandleIncidentFilterRoute(w, httptest.NewRequest("GET", "/incident/filter?includeTotal=true&count=2&cursor="+after, nil))
+
+	res := struct {
+		Page    int  `json:"page"`
+		HasMore bool `json:"hasMore"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Page != 2 || res.HasMore {
+		t.Errorf("Was `%s`;\nWant page 2 without more", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSearchRanksWithoutOrder(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT incident.id FROM incident "+
+		"WHERE (incident.search_vector @@ websearch_to_tsquery('english', $1)) "+
+		"ORDER BY ts_rank(incident.search_vector, websearch_to_tsquery('english', $2)) DESC, incident.id").
+		WithArgs("taser", "taser").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3).AddRow(1))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentFilterRoute(w, httptest.NewRequest("GET", "/incident/filter?q=taser", nil))
+
+	res := struct {
+		Rows []int `json:"rows"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 2 || res.Rows[0] != 3 || res.Rows[1] != 1 {
+		t.Errorf("Was `%s`;\nWant rows in rank order", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSearchKeepsExplicitOrder(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT incident.id FROM incident " +
+		"WHERE (incident.search_vector @@ websearch_to_tsquery('english', $1)) " +
+		"ORDER BY incident.id ASC NULLS LAST").
+		WithArgs("taser").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(3))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentFilterRoute(w, httptest.NewRequest("GET", "/incident/filter?q=taser&order=id", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Was status %d: %s", w.Code, w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// headlineSQL is the escaped and highlighted description selected for headline=true
+const headlineSQL = `ts_headline('english', replace(replace(replace(replace(replace(incident.description, ` +
+	`'&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'), ` +
+	`websearch_to_tsquery('english', $1), 'StartSel=<mark>, StopSel=</mark>, MaxFragments=3, FragmentDelimiter=" … "')`
+
+func TestFilterHeadline(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT incident.id, "+headlineSQL+" FROM incident "+
+		"WHERE (incident.search_vector @@ websearch_to_tsquery('english', $2)) "+
+		"ORDER BY ts_rank(incident.search_vector, websearch_to_tsquery('english', $3)) DESC, incident.id").
+		WithArgs("taser", "taser", "taser").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "headline"}).AddRow(3, "Hit with a <mark>taser</mark>"))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentFilterRoute(w, httptest.NewRequest("GET", "/incident/filter?q=taser&headline=true", nil))
+
+	res := struct {
+		Rows []filterHeadlineRow `json:"rows"`
+	}{}
+	if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Rows) != 1 || res.Rows[0].ID != 3 || res.Rows[0].Headline != "Hit with a <mark>taser</mark>" {
+		t.Errorf("Was `%s`;\nWant incident 3 with its headline", w.Body.String())
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
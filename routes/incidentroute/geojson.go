@@ -0,0 +1,169 @@
+package incidentroute
+
+import (
+	"database/sql"
+	"net/http"
+	"strings"
+
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+type format int
+
+const (
+	formatJSON format = iota
+	formatGeoJSON
+)
+
+var querystringToFormat = map[string]format{
+	"json":    formatJSON,
+	"geojson": formatGeoJSON,
+}
+
+var geoJSONEnvelope = shared.Envelope{
+	ContentType: "application/geo+json",
+	RowsKey:     "features",
+	Fields: map[string]interface{}{
+		"type": "FeatureCollection",
+	},
+}
+
+// geoProperty is a rowKindDetail column that can be
+// included in the properties of a GeoJSON feature
+type geoProperty struct {
+	Column string
+	// Join is the table the column comes from, if not incident
+	Join string
+}
+
+// Properties use the JSON names from detailRow.
+// Enumerations are given by name.
+var geoProperties = map[string]geoProperty{
+	"name":        {"incident.name", ""},
+	"age":         {"incident.age", ""},
+	"date":        {"incident.date", ""},
+	"imageUrl":    {"incident.image_url", ""},
+	"isMale":      {"incident.is_male", ""},
+	"address":     {"incident.address", ""},
+	"description": {"incident.description", ""},
+	"articleUrl":  {"incident.article_url", ""},
+	"videoUrl":    {"incident.video_url", ""},
+	"zipcode":     {"incident.zipcode", ""},
+	"cause":       {"cause.name", "cause"},
+	"useOfForce":  {"use_of_force.name", "use_of_force"},
+	"race":        {"race.name", "race"},
+	"county":      {"county.name", "county"},
+	"agency":      {"agency.name", "agency"},
+	"city":        {"city.name", "city"},
+}
+
+type feature struct {
+	Type       string                 `json:"type"`
+	ID         int                    `json:"id"`
+	Geometry   *point                 `json:"geometry"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+type point struct {
+	Type string `json:"type"`
+	// Coordinates are longitude then latitude
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+func pickFormat(r *http.Request) format {
+	querystrings, ok := r.URL.Query()["format"]
+	if !ok {
+		return formatJSON
+	}
+	f, ok := querystringToFormat[querystrings[0]]
+	if !ok {
+		shared.InvalidParam(r, "format", "expected json or geojson")
+		return formatJSON
+	}
+	return f
+}
+
+// pickGeoProperties reads properties=name,date,... in request order
+func pickGeoProperties(r *http.Request) []string {
+	names := []string{}
+	querystrings, ok := r.URL.Query()["properties"]
+	if !ok {
+		return names
+	}
+	for _, querystring := range querystrings {
+		for _, name := range strings.Split(querystring, ",") {
+			if _, ok := geoProperties[name]; ok {
+				names = append(names, name)
+			} else {
+				shared.InvalidParam(r, "properties", "unknown property "+name)
+			}
+		}
+	}
+	return names
+}
+
+// handleGeoJSON responds with a FeatureCollection of the incidents
+// matching where, with the requested properties
+func (h *Handler) handleGeoJSON(w http.ResponseWriter, r *http.Request, where, order query.Clauser) {
+	names := pickGeoProperties(r)
+	q := query.NewQuery()
+	q.AddClause(selectGeoJSONClause(names))
+	q.AddClause(geoJSONJoins(names))
+	q.AddClause(where)
+	q.AddClause(order)
+	h.HandleEnvelopeRoute(w, r, q, geoJSONTranslator(names), geoJSONEnvelope)
+}
+
+func selectGeoJSONClause(names []string) query.Clauser {
+	columns := append([]string{}, rowNames[rowKindPosition]...)
+	for _, name := range names {
+		columns = append(columns, geoProperties[name].Column)
+	}
+	return query.NewSelectClause("incident", columns)
+}
+
+func geoJSONJoins(names []string) query.Clauser {
+	expr := query.NewSubexpression(" ")
+	joined := map[string]bool{}
+	for _, name := range names {
+		table := geoProperties[name].Join
+		if table != "" && !joined[table] {
+			expr.AddClause(query.NewLeftJoinClause(table))
+			joined[table] = true
+		}
+	}
+	return expr
+}
+
+func geoJSONTranslator(names []string) shared.RowTranslatorFunc {
+	return func(rows *sql.Rows) (interface{}, error) {
+		var (
+			id        int
+			latitude  *float64
+			longitude *float64
+		)
+		values := make([]interface{}, len(names))
+		targets := []interface{}{&id, &latitude, &longitude}
+		for i := range values {
+			targets = append(targets, &values[i])
+		}
+		err := rows.Scan(targets...)
+		if err != nil {
+			return nil, err
+		}
+
+		f := feature{"Feature", id, nil, map[string]interface{}{}}
+		if latitude != nil && longitude != nil {
+			f.Geometry = &point{"Point", [2]float64{*longitude, *latitude}}
+		}
+		for i, name := range names {
+			value := values[i]
+			if bytes, ok := value.([]byte); ok {
+				value = string(bytes)
+			}
+			f.Properties[name] = value
+		}
+		return f, nil
+	}
+}
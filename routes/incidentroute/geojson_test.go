@@ -0,0 +1,104 @@
+package incidentroute
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/tim-harding/fatal-encounters-server/config"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+func newHandler(t *testing.T) (*Handler, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return New(shared.NewServer(db, config.Default())), mock
+}
+
+func TestPositionGeoJSON(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT incident.id, incident.latitude, incident.longitude, incident.name, cause.name " +
+		"FROM incident LEFT JOIN cause ON cause_id=cause.id").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "latitude", "longitude", "name", "name"}).
+			AddRow(1, 45.5, -122.5, "Jane Doe", "Gunshot").
+			AddRow(2, nil, nil, nil, "Taser"))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentPositionRoute(w, httptest.NewRequest("GET", "/incident/position?format=geojson&properties=name,cause", nil))
+
+	const wanted = `{"features":[` +
+		`{"type":"Feature","id":1,"geometry":{"type":"Point","coordinates":[-122.5,45.5]},"properties":{"cause":"Gunshot","name":"Jane Doe"}},` +
+		`{"type":"Feature","id":2,"geometry":null,"properties":{"cause":"Taser","name":null}}` +
+		`],"type":"FeatureCollection"}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/geo+json" {
+		t.Errorf("Was `%s`;\nWant `application/geo+json`", contentType)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGeoJSONCountyFilteredByState(t *testing.T) {
+	h, mock := newHandler(t)
+	// county has a state_id too, so the filter reads the incident's
+	mock.ExpectQuery("SELECT incident.id, incident.latitude, incident.longitude, county.name " +
+		"FROM incident LEFT JOIN county ON county_id=county.id " +
+		"WHERE (incident.state_id IN ($1)) ORDER BY incident.id ASC NULLS LAST").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "latitude", "longitude", "name"}).
+			AddRow(1, 45.5, -122.5, "Multnomah"))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentFilterRoute(w, httptest.NewRequest("GET", "/incident/filter?format=geojson&properties=county&state_id=5", nil))
+
+	const wanted = `{"features":[` +
+		`{"type":"Feature","id":1,"geometry":{"type":"Point","coordinates":[-122.5,45.5]},"properties":{"county":"Multnomah"}}` +
+		`],"type":"FeatureCollection"}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGeoJSONAgencyFilteredByState(t *testing.T) {
+	h, mock := newHandler(t)
+	// agency has a state_id of its own since agency metadata
+	mock.ExpectQuery("SELECT incident.id, incident.latitude, incident.longitude, agency.name " +
+		"FROM incident LEFT JOIN agency ON agency_id=agency.id " +
+		"WHERE (incident.state_id IN ($1)) ORDER BY incident.id ASC NULLS LAST").
+		WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "latitude", "longitude", "name"}).
+			AddRow(1, 45.5, -122.5, "Portland Police Bureau"))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentFilterRoute(w, httptest.NewRequest("GET", "/incident/filter?format=geojson&properties=agency&state_id=5", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Was %d;\nWant %d", w.Code, http.StatusOK)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGeoJSONRejectsPaging(t *testing.T) {
+	h, _ := newHandler(t)
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/incident/filter?format=geojson&count=2&strict=true", nil)
+	h.ValidateParams(http.HandlerFunc(h.HandleIncidentFilterRoute)).ServeHTTP(w, r)
+
+	const wanted = `{"code":400,"message":"not supported with format=geojson","field":"count",` +
+		`"details":[{"field":"count","message":"not supported with format=geojson"}]}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+}
@@ -0,0 +1,324 @@
+package incidentroute
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/tim-harding/fatal-encounters-server/openapi"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+var (
+	detailSchema   = openapi.Named("IncidentDetail", openapi.SchemaOf(detailRow{}))
+	positionSchema = openapi.Named("IncidentPosition", openapi.SchemaOf(positionRow{}))
+	countsSchema   = openapi.Named("IncidentCounts", openapi.SchemaOf(countsResponse{}))
+	headlineSchema = openapi.Named("IncidentHeadline", openapi.SchemaOf(filterHeadlineRow{}))
+	seriesSchema   = openapi.Named("IncidentTimeseries", timeseriesBody())
+	crosstabSchema = openapi.Named("IncidentCrosstab", openapi.SchemaOf(crosstabResponse{}))
+	profileSchema  = openapi.Named("AgencyProfile", openapi.SchemaOf(agencyProfile{}))
+	tilesSchema    = openapi.Named("IncidentTile", openapi.Object(map[string]*openapi.Schema{
+		"tile":     openapi.SchemaOf(tile{}),
+		"clusters": openapi.Array(openapi.SchemaOf(cluster{})),
+	}))
+	featuresSchema = openapi.Named("FeatureCollection", openapi.Object(map[string]*openapi.Schema{
+		"type":     openapi.Enum("FeatureCollection"),
+		"features": openapi.Array(openapi.Named("Feature", openapi.SchemaOf(feature{}))),
+	}))
+)
+
+// filterParameters documents the parameters read by whereClauseFilter
+func filterParameters() []openapi.Parameter {
+	parameters := []openapi.Parameter{}
+	for _, table := range idQueryTables {
+		name := fmt.Sprintf("%s_id", table)
+		description := fmt.Sprintf("Only incidents with these %s IDs", table)
+		parameters = append(parameters, openapi.QueryList(name, description, openapi.Integer()))
+	}
+	date := openapi.String()
+	date.Format = dateLayout
+	parameters = append(parameters, spatialParameters()...)
+	return append(
+		parameters,
+		openapi.Query("search", "Case insensitive substring of the victim's name", openapi.String()),
+		openapi.Query("q", "Full text search of descriptions, names, addresses, agencies and cities. "+
+			"Supports quoted phrases, `or` and `-` exclusions. Ranks the best matches first unless `order` is given.", openapi.String()),
+		openapi.Query("ageMin", "Minimum age, inclusive", openapi.Integer()),
+		openapi.Query("ageMax", "Maximum age, inclusive", openapi.Integer()),
+		openapi.Query("gender", "Victim's gender", openapi.Enum("male", "female")),
+		openapi.Query("agencyType", "Only incidents involving an agency of this type", openapi.Enum(shared.AgencyTypes...)),
+		openapi.Query("dateMin", "Earliest date, inclusive, e.g. 2020-Jan-31", date),
+		openapi.Query("dateMax", "Latest date, inclusive, e.g. 2020-Jan-31", date),
+	)
+}
+
+// headlineParameter documents the parameter read by headlineTerm
+func headlineParameter() openapi.Parameter {
+	description := "Include a snippet of the description with the matches for q in <mark> tags"
+	return openapi.Query("headline", description, openapi.Boolean())
+}
+
+// spatialParameters documents the parameters read by spatialClauses
+func spatialParameters() []openapi.Parameter {
+	return []openapi.Parameter{
+		openapi.QueryList("bbox", "Bounding box as minLng,minLat,maxLng,maxLat", &openapi.Schema{Type: "number"}),
+		openapi.QueryList("near", "Center as lat,lng for radiusKm", &openapi.Schema{Type: "number"}),
+		openapi.Query("radiusKm", "Distance from near in kilometers", &openapi.Schema{Type: "number"}),
+	}
+}
+
+// formatParameters documents the parameters read by pickFormat and pickGeoProperties
+func formatParameters() []openapi.Parameter {
+	properties := []string{}
+	for name := range geoProperties {
+		properties = append(properties, name)
+	}
+	sort.Strings(properties)
+	return []openapi.Parameter{
+		openapi.Query("format", "Response format", openapi.Enum("json", "geojson")),
+		openapi.QueryList("properties", "Incident fields to include in GeoJSON feature properties", openapi.Enum(properties...)),
+	}
+}
+
+// withGeoJSON documents the FeatureCollection sent for format=geojson
+func withGeoJSON(responses map[string]*openapi.Response) map[string]*openapi.Response {
+	responses["200"].Content[geoJSONEnvelope.ContentType] = openapi.MediaType{Schema: featuresSchema}
+	return responses
+}
+
+// orderParameters documents the parameters read by orderClause
+func orderParameters() []openapi.Parameter {
+	return []openapi.Parameter{
+		openapi.Query("order", "Sort column", openapi.Enum(orderKindColumns[:]...)),
+		openapi.Query("orderDirection", "Sort direction", openapi.Enum("ascending", "descending")),
+	}
+}
+
+// pageParameters documents the parameters read by pickFilterPage
+func pageParameters() []openapi.Parameter {
+	return []openapi.Parameter{
+		openapi.Query("count", "Rows per page, or all rows if less than one. Defaults to all rows.", openapi.Integer()),
+		openapi.Query("cursor", "The nextCursor of the previous page, made with the same order", openapi.String()),
+		shared.IncludeTotalParameter(),
+	}
+}
+
+// withNextCursor documents the nextCursor sent with paged responses
+// and the fields added by includeTotal
+func withNextCursor(responses map[string]*openapi.Response) map[string]*openapi.Response {
+	next := openapi.String()
+	next.Nullable = true
+	next.Description = "Cursor for the next page, or null after the last page. Only sent when count is given."
+	body := responses["200"].Content["application/json"].Schema
+	body.Properties["nextCursor"] = next
+	// Sent with includeTotal=true
+	body.Properties["total"] = openapi.Integer()
+	number := openapi.Integer()
+	number.Description = "Zero-based page number, counted as the pages of count before the cursor"
+	body.Properties["page"] = number
+	body.Properties["count"] = openapi.Integer()
+	body.Properties["hasMore"] = openapi.Boolean()
+	return responses
+}
+
+// jsonOnly notes on the parameters in geoJSONUnsupported
+// that they are ignored, or rejected in strict mode, for GeoJSON
+func jsonOnly(parameters []openapi.Parameter) []openapi.Parameter {
+	for i, parameter := range parameters {
+		for _, name := range geoJSONUnsupported {
+			if parameter.Name == name {
+				parameters[i].Description += " Not supported with format=geojson."
+			}
+		}
+	}
+	return parameters
+}
+
+// FilterOperation documents /incident/filter
+func FilterOperation() openapi.Operation {
+	parameters := append(append(filterParameters(), orderParameters()...), pageParameters()...)
+	return openapi.Operation{
+		OperationID: "filterIncidents",
+		Summary:     "List the IDs of incidents matching the filters, or IDs with headlines",
+		Tags:        []string{"incident"},
+		Parameters:  jsonOnly(append(append(parameters, headlineParameter()), formatParameters()...)),
+		Responses:   withGeoJSON(withNextCursor(shared.ListResponses("Incident IDs", openapi.OneOf(openapi.Integer(), headlineSchema)))),
+	}
+}
+
+// PositionOperation documents /incident/position
+func PositionOperation() openapi.Operation {
+	return openapi.Operation{
+		OperationID: "listIncidentPositions",
+		Summary:     "List the location of every incident, optionally within an area",
+		Tags:        []string{"incident"},
+		Parameters:  append(spatialParameters(), formatParameters()...),
+		Responses:   withGeoJSON(shared.ListResponses("Incident positions", positionSchema)),
+	}
+}
+
+// DetailOperation documents /incident/detail/{id}
+func DetailOperation() openapi.Operation {
+	return openapi.Operation{
+		OperationID: "getIncidents",
+		Summary:     "Get incidents by ID",
+		Tags:        []string{"incident"},
+		Parameters: []openapi.Parameter{
+			shared.IDParameter(),
+			openapi.Query("q", "Full text search term to highlight", openapi.String()),
+			headlineParameter(),
+		},
+		Responses: shared.ListResponses("Incidents", detailSchema),
+	}
+}
+
+// TilesOperation documents /incident/tiles/{z}/{x}/{y}
+func TilesOperation() openapi.Operation {
+	tileParameter := func(name, description string) openapi.Parameter {
+		return openapi.Parameter{
+			Name:        name,
+			In:          "path",
+			Description: description,
+			Required:    true,
+			Schema:      openapi.Integer(),
+		}
+	}
+	parameters := []openapi.Parameter{
+		tileParameter("z", "Zoom level"),
+		tileParameter("x", "Tile column, counting east from the antimeridian"),
+		tileParameter("y", "Tile row, counting south from the north edge"),
+		openapi.Query("grid", "Clusters per tile side, from 1 to 256. Defaults to 16.", openapi.Integer()),
+	}
+	return openapi.Operation{
+		OperationID: "getIncidentTile",
+		Summary:     "Cluster the incidents matching the filters in a Web Mercator map tile",
+		Tags:        []string{"incident"},
+		Parameters:  append(parameters, filterParameters()...),
+		Responses:   shared.Responses("Incident clusters", tilesSchema),
+	}
+}
+
+// ExportOperation documents /incident/export
+func ExportOperation() openapi.Operation {
+	formats := []string{}
+	for name := range querystringToExportFormat {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	parameters := []openapi.Parameter{
+		openapi.Query("format", "File format. Defaults to csv.", openapi.Enum(formats...)),
+	}
+	responses := shared.Responses("Incidents, one per line", detailSchema)
+	responses["200"].Content = map[string]openapi.MediaType{
+		exportContentTypes[exportFormatCSV]:    {Schema: openapi.String()},
+		exportContentTypes[exportFormatNDJSON]: {Schema: detailSchema},
+	}
+	return openapi.Operation{
+		OperationID: "exportIncidents",
+		Summary:     "Download every incident matching the filters",
+		Tags:        []string{"incident"},
+		Parameters:  append(append(parameters, filterParameters()...), orderParameters()...),
+		Responses:   responses,
+	}
+}
+
+// rateParameter documents the parameter read by pickRate
+func rateParameter() openapi.Parameter {
+	description := "Add the rate per 100,000 people for counts keyed by state, county or race, " +
+		"or for an unsplit series, using the populations loaded by the importer. A single state_id, county_id or race_id " +
+		"filter narrows the population; filters it can't follow are rejected."
+	return openapi.Query("rate", description, openapi.Enum("per100k"))
+}
+
+// facetsParameter documents the parameter read by pickFacets
+func facetsParameter() openapi.Parameter {
+	names := facetNames()
+	description := fmt.Sprintf("Dimensions to count by, from %s. "+
+		"Each may be followed by :top=N for the N most common values, and age by :width=N for N-year buckets, "+
+		"e.g. race,agency:top=5,age:width=10. Defaults to %s.", strings.Join(names, ", "), strings.Join(defaultFacets, ","))
+	return openapi.QueryList("facets", description, openapi.String())
+}
+
+// TimeseriesOperation documents /incident/timeseries
+func TimeseriesOperation() openapi.Operation {
+	parameters := []openapi.Parameter{
+		openapi.Query("interval", "Length of each period. Defaults to month.", openapi.Enum(intervalNames()...)),
+		openapi.Query("by", "Facet to split each period by, leaving out incidents without a value", openapi.Enum(facetNames()...)),
+		rateParameter(),
+	}
+	return openapi.Operation{
+		OperationID: "getIncidentTimeseries",
+		Summary:     "Count incidents matching the filters in each period, with periods without incidents counted as zero",
+		Tags:        []string{"incident"},
+		Parameters:  append(parameters, filterParameters()...),
+		Responses:   shared.Responses("Incident counts per period", seriesSchema),
+	}
+}
+
+func timeseriesBody() *openapi.Schema {
+	body := openapi.Object(map[string]*openapi.Schema{
+		"interval": openapi.Enum(intervalNames()...),
+		"rows":     openapi.Array(openapi.SchemaOf(periodCount{})),
+	})
+	// Only sent when splitting
+	body.Properties["by"] = openapi.Enum(facetNames()...)
+	return body
+}
+
+func facetNames() []string {
+	names := []string{}
+	for name := range facets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CountOperation documents /incident/count
+func CountOperation() openapi.Operation {
+	return openapi.Operation{
+		OperationID: "countIncidents",
+		Summary:     "Count incidents matching the filters by race, cause, year and age, or the chosen facets",
+		Tags:        []string{"incident"},
+		Parameters:  append(append(filterParameters(), orderParameters()...), facetsParameter(), rateParameter()),
+		Responses:   shared.Responses("Incident counts and matching IDs", countsSchema),
+	}
+}
+
+// CrosstabOperation documents /incident/crosstab
+func CrosstabOperation() openapi.Operation {
+	names := strings.Join(facetNames(), ", ")
+	parameters := []openapi.Parameter{
+		openapi.Query("rows", fmt.Sprintf("Facet for the rows, from %s. Age may be followed by :width=N. Defaults to %s.",
+			names, defaultCrosstabRows), openapi.String()),
+		openapi.Query("cols", fmt.Sprintf("Facet for the columns, as for rows. Defaults to %s.", defaultCrosstabCols), openapi.String()),
+	}
+	return openapi.Operation{
+		OperationID: "crosstabIncidents",
+		Summary:     "Count incidents matching the filters by each pair of keys of two facets, with totals",
+		Tags:        []string{"incident"},
+		Parameters:  append(parameters, filterParameters()...),
+		Responses:   shared.Responses("Incident count matrix", crosstabSchema),
+	}
+}
+
+// AgencyProfileOperation documents /agency/{id}/profile
+func AgencyProfileOperation() openapi.Operation {
+	return openapi.Operation{
+		OperationID: "getAgencyProfile",
+		Summary:     "Summarize the incidents of an agency by year, cause, use of force, race, state and county",
+		Tags:        []string{"agency"},
+		Parameters: []openapi.Parameter{
+			{
+				Name:        "id",
+				In:          "path",
+				Description: "Agency ID",
+				Required:    true,
+				Schema:      openapi.Integer(),
+			},
+			openapi.Query("recent", fmt.Sprintf("Number of latest incidents to include, from 0 to %d. Defaults to %d.",
+				maxRecentIncidents, defaultRecentIncidents), openapi.Integer()),
+		},
+		Responses: shared.Responses("Agency profile", profileSchema),
+	}
+}
@@ -2,10 +2,10 @@ package incidentroute
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
 
 	"github.com/tim-harding/fatal-encounters-server/query"
-	"github.com/tim-harding/fatal-encounters-server/shared"
 )
 
 type position struct {
@@ -19,16 +19,32 @@ type positionRow struct {
 }
 
 // HandleIncidentPositionRoute handles requests to /incident/position
-func HandleIncidentPositionRoute(w http.ResponseWriter, r *http.Request) {
-	shared.HandleRoute(w, r, buildPositionQuery(), translatePositionRow)
+func (h *Handler) HandleIncidentPositionRoute(w http.ResponseWriter, r *http.Request) {
+	if pickFormat(r) == formatGeoJSON {
+		h.handleGeoJSON(w, r, whereClausePosition(r), nil)
+		return
+	}
+	h.HandleRoute(w, r, buildPositionQuery(r), translatePositionRow)
 }
 
-func buildPositionQuery() query.Clauser {
+// buildPositionQuery skips incidents without coordinates, which GeoJSON
+// gives a null geometry but a position row has no way to show
+func buildPositionQuery(r *http.Request) query.Clauser {
+	where := whereClausePosition(r)
+	where.AddClause(query.NewRawSQL(fmt.Sprintf("%s IS NOT NULL", latitudeColumn)))
+	where.AddClause(query.NewRawSQL(fmt.Sprintf("%s IS NOT NULL", longitudeColumn)))
 	q := query.NewQuery()
 	q.AddClause(selectClause(rowKindPosition))
+	q.AddClause(where)
 	return q
 }
 
+func whereClausePosition(r *http.Request) query.Subclauser {
+	w := query.NewWhereClause(query.CombinatorAnd)
+	w.AddClause(spatialClauses(r))
+	return w
+}
+
 func translatePositionRow(rows *sql.Rows) (interface{}, error) {
 	row := positionRow{}
 	err := rows.Scan(
@@ -0,0 +1,26 @@
+package incidentroute
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestPositionSkipsMissingCoordinates(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT incident.id, incident.latitude, incident.longitude FROM incident " +
+		"WHERE (incident.latitude IS NOT NULL AND incident.longitude IS NOT NULL)").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "latitude", "longitude"}).AddRow(1, 45.5, -122.5))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentPositionRoute(w, httptest.NewRequest("GET", "/incident/position", nil))
+
+	const wanted = `{"rows":[{"id":1,"position":{"lat":45.5,"lng":-122.5}}]}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,222 @@
+package incidentroute
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+const (
+	defaultRecentIncidents = 5
+	maxRecentIncidents     = 50
+)
+
+// namedCount is the number of incidents for a row of an enum table
+type namedCount struct {
+	ID    int    `json:"id"`
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+type agencyProfile struct {
+	Agency enum `json:"agency"`
+	Total  int  `json:"total"`
+	// Years counts incidents per year, leaving out years without any
+	Years      []countFor   `json:"years"`
+	Causes     []namedCount `json:"causes"`
+	UseOfForce []namedCount `json:"useOfForce"`
+	Races      []namedCount `json:"races"`
+	States     []namedCount `json:"states"`
+	Counties   []namedCount `json:"counties"`
+	// Recent are the latest incidents, newest first
+	Recent []detailRow `json:"recent"`
+}
+
+// HandleAgencyProfileRoute handles requests to /agency/{id}/profile
+func (h *Handler) HandleAgencyProfileRoute(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		shared.FieldErrors(w, []shared.FieldError{{Field: "id", Message: "expected an integer"}})
+		return
+	}
+	recent := pickRecentIncidents(r)
+	q := agencyQuery(id)
+	h.Cached(w, r, q, func(w http.ResponseWriter) bool {
+		profile, err := h.queryAgencyProfile(r.Context(), q, id, recent)
+		if err == sql.ErrNoRows {
+			shared.Error(w, fmt.Errorf("no agency %d", id), http.StatusNotFound)
+			return false
+		}
+		if err != nil {
+			shared.QueryError(w, r, err)
+			return false
+		}
+		return writeJSON(w, profile)
+	})
+}
+
+func pickRecentIncidents(r *http.Request) int {
+	ok, recent := shared.MaybeQueryInt(r, "recent")
+	if !ok {
+		return defaultRecentIncidents
+	}
+	if recent < 0 || recent > maxRecentIncidents {
+		shared.InvalidParam(r, "recent", fmt.Sprintf("expected from 0 to %d", maxRecentIncidents))
+		return defaultRecentIncidents
+	}
+	return recent
+}
+
+func (h *Handler) queryAgencyProfile(ctx context.Context, agency query.Clauser, id, recent int) (agencyProfile, error) {
+	profile := agencyProfile{}
+	var err error
+	profile.Agency, err = h.queryAgency(ctx, agency)
+	if err != nil {
+		return profile, err
+	}
+	profile.Years, err = queryCountFor(ctx, agencyYearsQuery(id), h.Store, false)
+	if err != nil {
+		return profile, err
+	}
+	for _, year := range profile.Years {
+		profile.Total += year.Count
+	}
+	breakdowns := []struct {
+		target *[]namedCount
+		joins  []string
+	}{
+		{&profile.Causes, []string{"cause"}},
+		{&profile.UseOfForce, []string{"use_of_force"}},
+		{&profile.Races, []string{"race"}},
+		{&profile.States, []string{"state"}},
+		{&profile.Counties, []string{"county"}},
+	}
+	for _, breakdown := range breakdowns {
+		*breakdown.target, err = h.queryNamedCounts(ctx, agencyBreakdownQuery(id, breakdown.joins))
+		if err != nil {
+			return profile, err
+		}
+	}
+	profile.Recent = []detailRow{}
+	if recent > 0 {
+		profile.Recent, err = h.queryRecentIncidents(ctx, agencyRecentQuery(id, recent))
+	}
+	return profile, err
+}
+
+func agencyQuery(id int) query.Clauser {
+	q := query.NewQuery()
+	q.AddClause(query.NewSelectClause("agency", []string{"id", "name"}))
+	q.AddClause(agencyWhere("agency.id", id))
+	return q
+}
+
+func agencyWhere(column string, id int) query.Clauser {
+	w := query.NewWhereClause(query.CombinatorAnd)
+	w.AddClause(query.NewCompareClause(query.ComparisonEqual, column, id))
+	return w
+}
+
+// involving limits q to the incidents the agency was involved in,
+// whether or not it was the lead agency
+func involving(q query.Subclauser, id int) {
+	q.AddClause(query.NewRawSQL(sqlAgencyLink))
+	q.AddClause(agencyWhere("incident_agency.agency_id", id))
+}
+
+// agencyYearsQuery counts the agency's incidents per year
+func agencyYearsQuery(id int) query.Clauser {
+	year := facetKey(facetRequest{Name: "year"})
+	q := query.NewQuery()
+	q.AddClause(query.NewSelectClause("incident", []string{year, "COUNT(1)"}))
+	involving(q, id)
+	q.AddClause(query.NewGroupClause("1"))
+	q.AddClause(query.NewRawSQL("ORDER BY 1"))
+	return q
+}
+
+// agencyBreakdownQuery counts the agency's incidents for each row of the
+// last of the joined tables, most common first
+func agencyBreakdownQuery(id int, joins []string) query.Clauser {
+	table := joins[len(joins)-1]
+	columns := []string{fmt.Sprintf("%s.id", table), fmt.Sprintf("%s.name", table), "COUNT(1)"}
+	q := query.NewQuery()
+	q.AddClause(query.NewSelectClause("incident", columns))
+	for _, join := range joins {
+		q.AddClause(query.NewJoinClause(join))
+	}
+	involving(q, id)
+	q.AddClause(query.NewGroupClause("1, 2"))
+	q.AddClause(query.NewRawSQL("ORDER BY 3 DESC, 2"))
+	return q
+}
+
+// agencyRecentQuery selects the details of the agency's latest incidents
+func agencyRecentQuery(id, recent int) query.Clauser {
+	q := query.NewQuery()
+	q.AddClause(buildDetailQuery(selectClause(rowKindDetail)))
+	involving(q, id)
+	q.AddClause(query.NewKeysetOrderClause(query.OrderingDescending, []string{"incident.date", "incident.id"}))
+	q.AddClause(query.NewPageClause(recent, 0))
+	return q
+}
+
+// queryAgency gets the agency's name, or sql.ErrNoRows if there is no such agency
+func (h *Handler) queryAgency(ctx context.Context, q query.Clauser) (enum, error) {
+	agency := enum{}
+	rows, err := h.QueryRows(ctx, q)
+	if err != nil {
+		return agency, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		err = rows.Err()
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return agency, err
+	}
+	err = rows.Scan(&agency.ID, &agency.Name)
+	return agency, err
+}
+
+func (h *Handler) queryNamedCounts(ctx context.Context, q query.Clauser) ([]namedCount, error) {
+	rows, err := h.QueryRows(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []namedCount{}
+	for rows.Next() {
+		count := namedCount{}
+		err := rows.Scan(&count.ID, &count.Name, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, count)
+	}
+	return out, rows.Err()
+}
+
+func (h *Handler) queryRecentIncidents(ctx context.Context, q query.Clauser) ([]detailRow, error) {
+	rows, err := h.QueryRows(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []detailRow{}
+	for rows.Next() {
+		row, err := scanDetailRow(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, row.(detailRow))
+	}
+	return out, rows.Err()
+}
@@ -0,0 +1,79 @@
+package incidentroute
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi"
+)
+
+func profileRequest(id, querystring string) *http.Request {
+	r := httptest.NewRequest("GET", "/agency/"+id+"/profile"+querystring, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestBreakdownQueryJoinsState(t *testing.T) {
+	q := agencyBreakdownQuery(7, []string{"state"})
+	const wanted = "SELECT state.id, state.name, COUNT(1) FROM incident " +
+		"JOIN state ON state_id=state.id " +
+		"LEFT JOIN incident_agency ON incident_agency.incident_id = incident.id " +
+		"WHERE (incident_agency.agency_id = $1) GROUP BY 1, 2 ORDER BY 3 DESC, 2"
+	if was := normalizeSpace(q.String()); was != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", was, wanted)
+	}
+}
+
+func TestAgencyProfile(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT id, name FROM agency WHERE (agency.id = $1)").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(7, "Springfield PD"))
+	// Counting every incident the agency was involved in
+	mock.ExpectQuery("SELECT EXTRACT(YEAR FROM incident.date)::INTEGER, COUNT(1) FROM incident " +
+		"LEFT JOIN incident_agency ON incident_agency.incident_id = incident.id " +
+		"WHERE (incident_agency.agency_id = $1) GROUP BY 1 ORDER BY 1").
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"year", "count"}).AddRow(2019, 2).AddRow(2020, 1))
+	for _, table := range []string{"cause", "use_of_force", "race", "state", "county"} {
+		joins := []string{table}
+		if table == "state" {
+			joins = []string{"state"}
+		}
+		mock.ExpectQuery(agencyBreakdownQuery(7, joins).String()).
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "name", "count"}).AddRow(1, table, 3))
+	}
+
+	w := httptest.NewRecorder()
+	h.HandleAgencyProfileRoute(w, profileRequest("7", "?recent=0"))
+
+	const wanted = `{"agency":{"id":7,"name":"Springfield PD"},"total":3,` +
+		`"years":[{"key":2019,"count":2},{"key":2020,"count":1}],` +
+		`"causes":[{"id":1,"name":"cause","count":3}],` +
+		`"useOfForce":[{"id":1,"name":"use_of_force","count":3}],` +
+		`"races":[{"id":1,"name":"race","count":3}],` +
+		`"states":[{"id":1,"name":"state","count":3}],` +
+		`"counties":[{"id":1,"name":"county","count":3}],` +
+		`"recent":[]}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+}
+
+func TestUnknownAgency(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT id, name FROM agency WHERE (agency.id = $1)").
+		WithArgs(8).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}))
+
+	w := httptest.NewRecorder()
+	h.HandleAgencyProfileRoute(w, profileRequest("8", ""))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Was `%d`;\nWant `%d`", w.Code, http.StatusNotFound)
+	}
+}
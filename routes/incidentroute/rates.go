@@ -0,0 +1,137 @@
+package incidentroute
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+// ratePlace holds the population_for state, county and race arguments
+// the filters pin a rate to. Each is NULL if unfiltered, or empty if
+// filtered to several, which no single population covers.
+type ratePlace struct {
+	State  string
+	County string
+	Race   string
+}
+
+// nationalPlace covers every state, county and race
+var nationalPlace = ratePlace{"NULL", "NULL", "NULL"}
+
+// countyState looks up the state of a county, which
+// the importer stores with county populations
+const countyState = "(SELECT county.state_id FROM county WHERE county.id = %s)"
+
+// unratedFilters narrow the people incidents are counted
+// among in ways the population estimates can't follow
+var unratedFilters = []string{"city_id", "ageMin", "ageMax", "gender", "bbox", "near"}
+
+// pickRate reads rate=per100k along with the place the filters pin the
+// population to, or nil if no rate was asked for. Filters the population
+// can't follow are an error.
+func pickRate(r *http.Request) (*ratePlace, error) {
+	querystrings, ok := r.URL.Query()["rate"]
+	if !ok {
+		return nil, nil
+	}
+	if querystrings[0] != "per100k" {
+		shared.InvalidParam(r, "rate", "expected per100k")
+		return nil, nil
+	}
+	for _, key := range unratedFilters {
+		if _, ok := r.URL.Query()[key]; ok {
+			return nil, fmt.Errorf("rates can't be filtered by %s", key)
+		}
+	}
+	place := nationalPlace
+	place.State = pickPlace(r, "state_id")
+	place.County = pickPlace(r, "county_id")
+	place.Race = pickPlace(r, "race_id")
+	return &place, nil
+}
+
+// pickPlace gets the population_for argument for an ID filter.
+// Invalid IDs are reported by whereClauseFilter.
+func pickPlace(r *http.Request, key string) string {
+	querystrings, ok := r.URL.Query()[key]
+	if !ok {
+		return "NULL"
+	}
+	values := strings.Split(strings.Join(querystrings, ","), ",")
+	if len(values) > 1 {
+		return ""
+	}
+	id, err := strconv.Atoi(values[0])
+	if err != nil {
+		return "NULL"
+	}
+	return strconv.Itoa(id)
+}
+
+// population gets the population_for arguments with the given
+// dimension, if any, taken from key rather than the filters
+func (p ratePlace) population(dimension, key string) (string, error) {
+	switch dimension {
+	case "state":
+		p.State = key
+	case "county":
+		p.County = key
+	case "race":
+		p.Race = key
+	}
+	if p.County == "" {
+		return "", fmt.Errorf("rates need a single county_id or a county facet")
+	}
+	if p.County != "NULL" {
+		p.State = fmt.Sprintf(countyState, p.County)
+	}
+	if p.State == "" {
+		return "", fmt.Errorf("rates need a single state_id or a state or county facet")
+	}
+	if p.Race == "" {
+		return "", fmt.Errorf("rates need a single race_id or a race facet")
+	}
+	return fmt.Sprintf("%s, %s, %s", p.State, p.County, p.Race), nil
+}
+
+// checkRates makes sure a population covers the key of each facet with rates
+func checkRates(place *ratePlace, requests []facetRequest) error {
+	if place == nil {
+		return nil
+	}
+	for _, request := range requests {
+		_, err := facetPopulation(request, "key", *place)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rateColumn divides a count by the population for the year, or the latest
+// if year is NULL, and the given population_for arguments. The rate is NULL
+// where no population is loaded, or if population is empty.
+func rateColumn(count, year, population string) string {
+	if population == "" {
+		return "NULL::NUMERIC"
+	}
+	return fmt.Sprintf("%s * 100000.0 / population_for(%s, %s)", count, year, population)
+}
+
+// facetPopulation gets the population_for arguments for the key of a facet
+// in the place, or an empty string if it has no rates
+func facetPopulation(request facetRequest, key string, place ratePlace) (string, error) {
+	f := facets[request.Name]
+	if f.Population == "" || request.Width > 0 {
+		return "", nil
+	}
+	return place.population(f.Population, key)
+}
+
+// rateError responds that the rate can't be worked out for the filters
+func rateError(w http.ResponseWriter, err error) {
+	shared.FieldErrors(w, []shared.FieldError{{Field: "rate", Message: err.Error()}})
+}
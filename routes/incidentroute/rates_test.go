@@ -0,0 +1,57 @@
+package incidentroute
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRatePopulationFollowsFilters(t *testing.T) {
+	for _, c := range []struct {
+		querystring string
+		facet       string
+		wanted      string
+	}{
+		{"state_id=6", "race", "6, NULL, key"},
+		{"state_id=6", "", "6, NULL, NULL"},
+		{"county_id=3&state_id=6", "", "(SELECT county.state_id FROM county WHERE county.id = 3), 3, NULL"},
+		{"state_id=5,6", "state", "key, NULL, NULL"},
+		{"race_id=2&cause_id=1,4", "county", "(SELECT county.state_id FROM county WHERE county.id = key), key, 2"},
+	} {
+		r := httptest.NewRequest("GET", "/incident/count?rate=per100k&"+c.querystring, nil)
+		place, err := pickRate(r)
+		if err != nil {
+			t.Fatalf("%s: %v", c.querystring, err)
+		}
+		dimension := ""
+		if c.facet != "" {
+			dimension = facets[c.facet].Population
+		}
+		was, err := place.population(dimension, "key")
+		if err != nil {
+			t.Errorf("%s: %v", c.querystring, err)
+		} else if was != c.wanted {
+			t.Errorf("%s: Was `%s`;\nWant `%s`", c.querystring, was, c.wanted)
+		}
+	}
+}
+
+func TestRefusesRatesFiltersCantFollow(t *testing.T) {
+	h, _ := newHandler(t)
+	for _, path := range []string{
+		"/incident/count?rate=per100k&facets=race&state_id=5,6",
+		"/incident/count?rate=per100k&facets=state&gender=male",
+		"/incident/timeseries?rate=per100k&race_id=1,2",
+	} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", path, nil)
+		if r.URL.Path == "/incident/count" {
+			h.HandleCountRoute(w, r)
+		} else {
+			h.HandleIncidentTimeseriesRoute(w, r)
+		}
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: Was %d;\nWant %d", path, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -1,7 +1,40 @@
 package incidentroute
 
-import "github.com/tim-harding/fatal-encounters-server/query"
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+// Handler responds to /incident routes
+type Handler struct {
+	*shared.Server
+}
+
+// New creates a handler for /incident routes
+func New(s *shared.Server) *Handler {
+	return &Handler{s}
+}
 
 func selectClause(kind rowKind) query.Clauser {
 	return query.NewSelectClause("incident", rowNames[kind])
 }
+
+// selectHeadlineClause selects the columns for kind followed by
+// a snippet of the description showing where the search term matched
+func selectHeadlineClause(kind rowKind, term string) query.Clauser {
+	columns := []query.Clauser{}
+	for _, name := range rowNames[kind] {
+		columns = append(columns, query.NewRawSQL(name))
+	}
+	columns = append(columns, query.NewHeadlineClause(headlineColumn, term))
+	return query.NewSelectExprClause("incident", columns)
+}
+
+// writeJSON sends a JSON response, returning whether it was written
+func writeJSON(w http.ResponseWriter, res interface{}) bool {
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(res) == nil
+}
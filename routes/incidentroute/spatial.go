@@ -0,0 +1,97 @@
+package incidentroute
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+const (
+	latitudeColumn  = "incident.latitude"
+	longitudeColumn = "incident.longitude"
+)
+
+// spatialClauses creates the bbox and near/radiusKm filters
+func spatialClauses(r *http.Request) query.Clauser {
+	expr := query.NewConditionsClause(query.CombinatorAnd)
+	expr.AddClause(boundingBoxClause(r))
+	expr.AddClause(radiusClause(r))
+	return expr
+}
+
+// boundingBoxClause reads bbox=minLng,minLat,maxLng,maxLat
+func boundingBoxClause(r *http.Request) query.Clauser {
+	values, ok := queryFloats(r, "bbox", 4)
+	if !ok {
+		return nil
+	}
+	minLng, minLat, maxLng, maxLat := values[0], values[1], values[2], values[3]
+	if !validLongitude(minLng) || !validLongitude(maxLng) || !validLatitude(minLat) || !validLatitude(maxLat) || minLat > maxLat {
+		shared.InvalidParam(r, "bbox", "expected minLng,minLat,maxLng,maxLat within -180..180 and -90..90")
+		return nil
+	}
+	return query.NewBoundingBoxClause(latitudeColumn, longitudeColumn, minLng, minLat, maxLng, maxLat)
+}
+
+// radiusClause reads near=lat,lng and radiusKm
+func radiusClause(r *http.Request) query.Clauser {
+	_, hasNear := r.URL.Query()["near"]
+	_, hasRadius := r.URL.Query()["radiusKm"]
+	if !hasNear && !hasRadius {
+		return nil
+	}
+	if hasNear != hasRadius {
+		shared.InvalidParam(r, "near", "near and radiusKm must be given together")
+		return nil
+	}
+	near, nearOk := queryFloats(r, "near", 2)
+	radius, radiusOk := queryFloats(r, "radiusKm", 1)
+	if !nearOk || !radiusOk {
+		return nil
+	}
+	lat, lng := near[0], near[1]
+	if !validLatitude(lat) || !validLongitude(lng) {
+		shared.InvalidParam(r, "near", "expected lat,lng within -90..90 and -180..180")
+		return nil
+	}
+	if radius[0] <= 0 {
+		shared.InvalidParam(r, "radiusKm", "expected a positive distance")
+		return nil
+	}
+	return query.NewRadiusClause(latitudeColumn, longitudeColumn, lat, lng, radius[0]*1000)
+}
+
+// queryFloats reads exactly count comma-separated numbers.
+// Returns false if the parameter is missing or invalid.
+func queryFloats(r *http.Request, key string, count int) ([]float64, bool) {
+	querystrings, ok := r.URL.Query()[key]
+	if !ok || len(querystrings) < 1 {
+		return nil, false
+	}
+	parts := strings.Split(querystrings[0], ",")
+	if len(parts) != count {
+		shared.InvalidParam(r, key, "expected "+strconv.Itoa(count)+" comma-separated numbers")
+		return nil, false
+	}
+	values := make([]float64, 0, count)
+	for _, part := range parts {
+		value, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			shared.InvalidParam(r, key, "expected "+strconv.Itoa(count)+" comma-separated numbers")
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
+
+func validLatitude(lat float64) bool {
+	return lat >= -90 && lat <= 90
+}
+
+func validLongitude(lng float64) bool {
+	return lng >= -180 && lng <= 180
+}
@@ -0,0 +1,41 @@
+package incidentroute
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBoundingBoxParameter(t *testing.T) {
+	r := httptest.NewRequest("GET", "/incident/position?bbox=-123,45,-122,46", nil)
+	clause := boundingBoxClause(r)
+	if clause == nil {
+		t.Fatal("Expected a bounding box clause")
+	}
+	params := clause.Parameters()
+	if params[0] != 45.0 || params[1] != 46.0 || params[2] != -123.0 || params[3] != -122.0 {
+		t.Errorf("Unexpected parameters %v", params)
+	}
+}
+
+func TestInvalidSpatialParametersAreIgnored(t *testing.T) {
+	for _, querystring := range []string{
+		"bbox=1,2,3",
+		"bbox=-123,46,-122,45",
+		"near=45,-122",
+		"near=45,-122&radiusKm=-1",
+		"near=95,-122&radiusKm=1",
+	} {
+		r := httptest.NewRequest("GET", "/incident/position?"+querystring, nil)
+		if sql := spatialClauses(r).String(); sql != "" {
+			t.Errorf("%s: Was `%s`;\nWant ``", querystring, sql)
+		}
+	}
+}
+
+func TestRadiusParameterIsInMeters(t *testing.T) {
+	r := httptest.NewRequest("GET", "/incident/position?near=45,-122&radiusKm=2.5", nil)
+	params := radiusClause(r).Parameters()
+	if params[2] != 2500.0 {
+		t.Errorf("Was %v;\nWant 2500", params[2])
+	}
+}
@@ -0,0 +1,135 @@
+package incidentroute
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+const (
+	maxTileZoom     = 22
+	defaultGridSize = 16
+	maxGridSize     = 256
+)
+
+type tile struct {
+	Z int `json:"z"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type cluster struct {
+	Position position `json:"position"`
+	Count    int      `json:"count"`
+	// ID is set for clusters of a single incident
+	ID *int `json:"id,omitempty"`
+}
+
+// HandleIncidentTilesRoute handles requests to /incident/tiles/{z}/{x}/{y},
+// clustering the incidents that match the filters into a grid over the tile
+func (h *Handler) HandleIncidentTilesRoute(w http.ResponseWriter, r *http.Request) {
+	t, err := tileFromPath(r)
+	if err != nil {
+		shared.FieldErrors(w, []shared.FieldError{{Field: "tile", Message: err.Error()}})
+		return
+	}
+	envelope := shared.Envelope{
+		ContentType: "application/json",
+		RowsKey:     "clusters",
+		Fields: map[string]interface{}{
+			"tile": t,
+		},
+	}
+	h.HandleEnvelopeRoute(w, r, buildTilesQuery(r, t), translateClusterRow, envelope)
+}
+
+func tileFromPath(r *http.Request) (tile, error) {
+	t := tile{}
+	for _, part := range []struct {
+		key   string
+		value *int
+	}{{"z", &t.Z}, {"x", &t.X}, {"y", &t.Y}} {
+		value, err := strconv.Atoi(chi.URLParam(r, part.key))
+		if err != nil {
+			return t, fmt.Errorf("expected an integer %s", part.key)
+		}
+		*part.value = value
+	}
+	if t.Z < 0 || t.Z > maxTileZoom {
+		return t, fmt.Errorf("expected z from 0 to %d", maxTileZoom)
+	}
+	extent := 1 << uint(t.Z)
+	if t.X < 0 || t.X >= extent || t.Y < 0 || t.Y >= extent {
+		return t, fmt.Errorf("expected x and y from 0 to %d at zoom %d", extent-1, t.Z)
+	}
+	return t, nil
+}
+
+// bounds gets the west, south, east and north edges of the tile in degrees
+func (t tile) bounds() (float64, float64, float64, float64) {
+	n := float64(int(1) << uint(t.Z))
+	longitude := func(x int) float64 {
+		return float64(x)/n*360 - 180
+	}
+	latitude := func(y int) float64 {
+		return math.Atan(math.Sinh(math.Pi*(1-2*float64(y)/n))) * 180 / math.Pi
+	}
+	return longitude(t.X), latitude(t.Y + 1), longitude(t.X + 1), latitude(t.Y)
+}
+
+func pickGridSize(r *http.Request) int {
+	ok, size := shared.MaybeQueryInt(r, "grid")
+	if !ok {
+		return defaultGridSize
+	}
+	if size < 1 || size > maxGridSize {
+		shared.InvalidParam(r, "grid", fmt.Sprintf("expected from 1 to %d", maxGridSize))
+		return defaultGridSize
+	}
+	return size
+}
+
+func buildTilesQuery(r *http.Request, t tile) query.Clauser {
+	west, south, east, north := t.bounds()
+	columns := []query.Clauser{
+		query.NewGridClause(latitudeColumn, longitudeColumn, west, south, east, north, pickGridSize(r)),
+		query.NewRawSQL("COUNT(1)"),
+		query.NewRawSQL(fmt.Sprintf("AVG(%s)", latitudeColumn)),
+		query.NewRawSQL(fmt.Sprintf("AVG(%s)", longitudeColumn)),
+		query.NewRawSQL("MIN(incident.id)"),
+	}
+	where := whereClauseFilter(r)
+	where.AddClause(query.NewBoundingBoxClause(latitudeColumn, longitudeColumn, west, south, east, north))
+
+	q := query.NewQuery()
+	q.AddClause(query.NewSelectExprClause("incident", columns))
+	q.AddClause(where)
+	q.AddClause(query.NewGroupClause("1, 2"))
+	return q
+}
+
+func translateClusterRow(rows *sql.Rows) (interface{}, error) {
+	var (
+		x, y int
+		id   int
+	)
+	c := cluster{}
+	err := rows.Scan(
+		&x,
+		&y,
+		&c.Count,
+		&c.Position.Latitude,
+		&c.Position.Longitude,
+		&id,
+	)
+	if c.Count == 1 {
+		c.ID = &id
+	}
+	return c, err
+}
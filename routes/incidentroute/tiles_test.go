@@ -0,0 +1,68 @@
+package incidentroute
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi"
+)
+
+func TestTileBounds(t *testing.T) {
+	west, south, east, north := tile{1, 0, 0}.bounds()
+	wanted := [4]float64{-180, 0, 0, 85.0511287798}
+	for i, was := range [4]float64{west, south, east, north} {
+		if math.Abs(was-wanted[i]) > 1e-9 {
+			t.Errorf("Was `%v`;\nWant `%v`", was, wanted[i])
+		}
+	}
+}
+
+func tileRequest(z, x, y string) *http.Request {
+	r := httptest.NewRequest("GET", "/incident/tiles/"+z+"/"+x+"/"+y, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("z", z)
+	rctx.URLParams.Add("x", x)
+	rctx.URLParams.Add("y", y)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestTileOutOfRange(t *testing.T) {
+	h, _ := newHandler(t)
+	w := httptest.NewRecorder()
+	h.HandleIncidentTilesRoute(w, tileRequest("2", "4", "0"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Was `%d`;\nWant `%d`", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestTileClusters(t *testing.T) {
+	h, mock := newHandler(t)
+	mock.ExpectQuery("SELECT LEAST(GREATEST(FLOOR((incident.longitude - $1) * $2), 0), $3), "+
+		"LEAST(GREATEST(FLOOR(($4 - LN(TAN(PI() / 4 + RADIANS(incident.latitude) / 2))) * $5), 0), $6), "+
+		"COUNT(1), AVG(incident.latitude), AVG(incident.longitude), MIN(incident.id) "+
+		"FROM incident "+
+		"WHERE (incident.race_id IN ($7) AND "+
+		"(incident.latitude BETWEEN $8 AND $9 AND incident.longitude BETWEEN $10 AND $11)) GROUP BY 1, 2").
+		WithArgs(-180.0, 2/180.0, 1, sqlmock.AnyArg(), sqlmock.AnyArg(), 1, 3, 0.0, sqlmock.AnyArg(), -180.0, 0.0).
+		WillReturnRows(sqlmock.NewRows([]string{"x", "y", "count", "latitude", "longitude", "id"}).
+			AddRow(0, 1, 2, 10.5, -100.25, 4).
+			AddRow(1, 1, 1, 20, -30, 7))
+
+	r := tileRequest("1", "0", "0")
+	r.URL.RawQuery = "grid=2&race_id=3"
+	w := httptest.NewRecorder()
+	h.HandleIncidentTilesRoute(w, r)
+
+	const wanted = `{"clusters":[{"position":{"lat":10.5,"lng":-100.25},"count":2},` +
+		`{"position":{"lat":20,"lng":-30},"count":1,"id":7}],"tile":{"z":1,"x":0,"y":0}}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
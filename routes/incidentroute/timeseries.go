@@ -0,0 +1,174 @@
+package incidentroute
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tim-harding/fatal-encounters-server/query"
+	"github.com/tim-harding/fatal-encounters-server/shared"
+)
+
+// intervalSteps maps the interval parameter to the step between periods
+var intervalSteps = map[string]string{
+	"day":     "1 day",
+	"week":    "1 week",
+	"month":   "1 month",
+	"quarter": "3 months",
+	"year":    "1 year",
+}
+
+const defaultInterval = "month"
+
+type periodCount struct {
+	// Period is the first day of the period
+	Period string `json:"period"`
+	// Key is the value of the by facet, if any
+	Key   interface{} `json:"key,omitempty"`
+	Count int         `json:"count"`
+	// Rate is per 100,000 people, if requested and the population is known
+	Rate *float64 `json:"rate,omitempty"`
+}
+
+// HandleIncidentTimeseriesRoute handles requests to /incident/timeseries
+func (h *Handler) HandleIncidentTimeseriesRoute(w http.ResponseWriter, r *http.Request) {
+	interval := pickInterval(r)
+	by := pickSplit(r)
+	rate, err := pickRate(r)
+	if err == nil && rate != nil && by == "" {
+		_, err = rate.population("", "")
+	} else if err == nil {
+		err = checkRates(rate, []facetRequest{{Name: by}})
+	}
+	if err != nil {
+		rateError(w, err)
+		return
+	}
+	envelope := shared.RowsEnvelope
+	envelope.Fields = map[string]interface{}{
+		"interval": interval,
+	}
+	if by != "" {
+		envelope.Fields["by"] = by
+	}
+	h.HandleEnvelopeRoute(w, r, buildTimeseriesQuery(r, interval, by, rate), periodCountTranslator(rate != nil), envelope)
+}
+
+func pickInterval(r *http.Request) string {
+	querystrings, ok := r.URL.Query()["interval"]
+	if !ok {
+		return defaultInterval
+	}
+	if _, ok := intervalSteps[querystrings[0]]; !ok {
+		shared.InvalidParam(r, "interval", "expected "+strings.Join(intervalNames(), ", "))
+		return defaultInterval
+	}
+	return querystrings[0]
+}
+
+func intervalNames() []string {
+	names := []string{}
+	for name := range intervalSteps {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// pickSplit reads the facet to split the series by, if any
+func pickSplit(r *http.Request) string {
+	querystrings, ok := r.URL.Query()["by"]
+	if !ok {
+		return ""
+	}
+	if _, ok := facets[querystrings[0]]; !ok {
+		shared.InvalidParam(r, "by", "unknown facet "+querystrings[0])
+		return ""
+	}
+	return querystrings[0]
+}
+
+// buildTimeseriesQuery counts the filtered incidents in every period from
+// the first to the last with incidents, and for every key of the by facet,
+// with generate_series filling in the periods without any
+func buildTimeseriesQuery(r *http.Request, interval, by string, rate *ratePlace) query.Clauser {
+	key := "NULL::INTEGER"
+	where := whereClauseFilter(r)
+	if by != "" {
+		f := facets[by]
+		key = fmt.Sprintf(f.Key, f.Column)
+		// Incidents missing the value are left out, as with /incident/count
+		where.AddClause(query.NewRawSQL(fmt.Sprintf("%s IS NOT NULL", f.Column)))
+	}
+	columns := []string{
+		fmt.Sprintf("date_trunc('%s', incident.date)::DATE AS period", interval),
+		fmt.Sprintf("%s AS key", key),
+	}
+
+	q := query.NewQuery()
+	q.AddClause(query.NewRawSQL("WITH matched AS ("))
+	q.AddClause(query.NewSelectClause("incident", columns))
+	if by != "" && facets[by].Link != "" {
+		// Once for each key of the incident
+		q.AddClause(query.NewRawSQL(facets[by].Link))
+	}
+	q.AddClause(where)
+	q.AddClause(query.NewRawSQL(fmt.Sprintf(sqlTimeseries, intervalSteps[interval], timeseriesRate(by, rate))))
+	return q
+}
+
+// timeseriesRate is the rate column for each period and key, if requested.
+// Unsplit series use the population of the place the filters pin down.
+func timeseriesRate(by string, rate *ratePlace) string {
+	if rate == nil {
+		return ""
+	}
+	// The place was checked by checkRates
+	population, _ := rate.population("", "")
+	if by != "" {
+		population, _ = facetPopulation(facetRequest{Name: by}, "keys.key", *rate)
+	}
+	year := "EXTRACT(YEAR FROM periods.period)::INTEGER"
+	return ", " + rateColumn("COUNT(matched.period)", year, population)
+}
+
+const sqlTimeseries = `),
+	periods AS (
+		SELECT generate_series(MIN(period), MAX(period), '%s'::INTERVAL)::DATE AS period
+		FROM matched
+	),
+	keys AS (
+		SELECT DISTINCT key
+		FROM matched
+	)
+	SELECT periods.period, keys.key, COUNT(matched.period)%s
+	FROM periods
+	CROSS JOIN keys
+	LEFT JOIN matched
+	ON matched.period = periods.period
+	AND matched.key IS NOT DISTINCT FROM keys.key
+	GROUP BY 1, 2
+	ORDER BY 1, 2`
+
+func periodCountTranslator(rate bool) shared.RowTranslatorFunc {
+	return func(rows *sql.Rows) (interface{}, error) {
+		var period time.Time
+		row := periodCount{}
+		targets := []interface{}{&period, &row.Key, &row.Count}
+		if rate {
+			targets = append(targets, &row.Rate)
+		}
+		err := rows.Scan(targets...)
+		if err != nil {
+			return nil, err
+		}
+		row.Period = period.Format(isoDateLayout)
+		if bytes, ok := row.Key.([]byte); ok {
+			row.Key = string(bytes)
+		}
+		return row, nil
+	}
+}
@@ -0,0 +1,56 @@
+package incidentroute
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTimeseriesByRace(t *testing.T) {
+	h, mock := newHandler(t)
+	r := httptest.NewRequest("GET", "/incident/timeseries?interval=quarter&by=race&ageMin=18", nil)
+	q := buildTimeseriesQuery(r, pickInterval(r), pickSplit(r), nil)
+
+	const wanted = "WITH matched AS ( SELECT date_trunc('quarter', incident.date)::DATE AS period, incident.race_id AS key " +
+		"FROM incident WHERE (age >= $1 AND incident.race_id IS NOT NULL) ), " +
+		"periods AS ( SELECT generate_series(MIN(period), MAX(period), '3 months'::INTERVAL)::DATE AS period FROM matched ), " +
+		"keys AS ( SELECT DISTINCT key FROM matched ) SELECT periods.period, keys.key, COUNT(matched.period) " +
+		"FROM periods CROSS JOIN keys LEFT JOIN matched ON matched.period = periods.period " +
+		"AND matched.key IS NOT DISTINCT FROM keys.key GROUP BY 1, 2 ORDER BY 1, 2"
+	if was := normalizeSpace(q.String()); was != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", was, wanted)
+	}
+
+	quarter := func(month time.Month) time.Time {
+		return time.Date(2020, month, 1, 0, 0, 0, 0, time.UTC)
+	}
+	mock.ExpectQuery(q.String()).
+		WithArgs(18).
+		WillReturnRows(sqlmock.NewRows([]string{"period", "key", "count"}).
+			AddRow(quarter(1), 2, 3).
+			AddRow(quarter(4), 2, 0))
+
+	w := httptest.NewRecorder()
+	h.HandleIncidentTimeseriesRoute(w, r)
+
+	const body = `{"by":"race","interval":"quarter","rows":[` +
+		`{"period":"2020-01-01","key":2,"count":3},{"period":"2020-04-01","key":2,"count":0}]}` + "\n"
+	if w.Body.String() != body {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), body)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTimeseriesRate(t *testing.T) {
+	const wanted = ", COUNT(matched.period) * 100000.0 / population_for(EXTRACT(YEAR FROM periods.period)::INTEGER, NULL, NULL, NULL)"
+	if was := timeseriesRate("", &nationalPlace); was != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", was, wanted)
+	}
+	if was := timeseriesRate("cause", &nationalPlace); was != ", NULL::NUMERIC" {
+		t.Errorf("Was `%s`;\nWant `, NULL::NUMERIC`", was)
+	}
+}
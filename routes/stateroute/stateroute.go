@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/tim-harding/fatal-encounters-server/openapi"
 	"github.com/tim-harding/fatal-encounters-server/query"
 	"github.com/tim-harding/fatal-encounters-server/shared"
 )
@@ -21,22 +22,54 @@ var desiredRowNames = [...]string{
 	"shortname",
 }
 
-// HandleBaseRoute responds to /city queries
-func HandleBaseRoute(w http.ResponseWriter, r *http.Request) {
-	shared.HandleRoute(w, r, buildQuery(r), translateRow)
+var stateSchema = openapi.Named("State", openapi.SchemaOf(state{}))
+
+// Handler responds to /state routes
+type Handler struct {
+	*shared.Server
+}
+
+// New creates a handler for /state routes
+func New(s *shared.Server) *Handler {
+	return &Handler{s}
 }
 
-// HandleIDRoute responds to /city queries
-func HandleIDRoute(w http.ResponseWriter, r *http.Request) {
-	shared.HandleIDRoute(w, r, selectClause(), translateRow, "state")
+// HandleBaseRoute responds to /state queries
+func (h *Handler) HandleBaseRoute(w http.ResponseWriter, r *http.Request) {
+	h.HandleListRoute(w, r, buildQuery(r), orderClause(), translateRow)
+}
+
+// HandleIDRoute responds to /state/{id} queries
+func (h *Handler) HandleIDRoute(w http.ResponseWriter, r *http.Request) {
+	h.Server.HandleIDRoute(w, r, selectClause(), translateRow, "state")
+}
+
+// BaseOperation documents /state
+func BaseOperation() openapi.Operation {
+	return openapi.Operation{
+		OperationID: "listStates",
+		Summary:     "List states ordered by name. Two letter searches also match the postal abbreviation.",
+		Tags:        []string{"state"},
+		Parameters:  shared.ListParameters(),
+		Responses:   shared.PagedListResponses("States", stateSchema),
+	}
+}
+
+// IDOperation documents /state/{id}
+func IDOperation() openapi.Operation {
+	return openapi.Operation{
+		OperationID: "getStates",
+		Summary:     "Get states by ID",
+		Tags:        []string{"state"},
+		Parameters:  []openapi.Parameter{shared.IDParameter()},
+		Responses:   shared.ListResponses("States", stateSchema),
+	}
 }
 
 func buildQuery(r *http.Request) query.Clauser {
-	q := query.NewQuery()
+	q := query.NewSubexpression(" ")
 	q.AddClause(selectClause())
 	q.AddClause(whereClause(r))
-	q.AddClause(orderClause())
-	q.AddClause(shared.LimitClause(r))
 	return q
 }
 
@@ -0,0 +1,14 @@
+package shared
+
+// AgencyTypes are the values of agency.type, as checked by the schema
+var AgencyTypes = []string{"municipal", "sheriff", "state", "federal"}
+
+// IsAgencyType tells whether s is one of AgencyTypes
+func IsAgencyType(s string) bool {
+	for _, agencyType := range AgencyTypes {
+		if s == agencyType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,221 @@
+package shared
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tim-harding/fatal-encounters-server/cache"
+	"github.com/tim-harding/fatal-encounters-server/query"
+)
+
+// versionCheckInterval is how long the dataset version is trusted before
+// it is read again, and so how long responses may be stale after an import
+const versionCheckInterval = 5 * time.Second
+
+const sqlDatasetVersion = "SELECT version, updated_at FROM dataset_version"
+
+// datasetVersion identifies the loaded data. The importer bumps it.
+type datasetVersion struct {
+	Number    int
+	UpdatedAt time.Time
+}
+
+// versionCheck remembers the last read of the dataset version
+type versionCheck struct {
+	mu      sync.Mutex
+	version datasetVersion
+	err     error
+	checked time.Time
+	// reading is closed when the read in progress finishes, nil if none is
+	reading chan struct{}
+}
+
+// Cached answers a request from the cache, or lets respond write the response
+// and stores it if respond reports success. The query is part of the cache key.
+// Successful responses carry an ETag and Last-Modified from the dataset
+// version, and requests that already hold them get 304 Not Modified.
+func (s *Server) Cached(w http.ResponseWriter, r *http.Request, q query.Clauser, respond func(w http.ResponseWriter) bool) {
+	if !CheckParams(w, r) {
+		return
+	}
+	if s.cache == nil {
+		respond(w)
+		return
+	}
+	version, err := s.datasetVersion(r.Context())
+	if err != nil {
+		log.Printf("Not caching: %v", err)
+		respond(w)
+		return
+	}
+
+	key := cache.Key(r, q)
+	validators := http.Header{}
+	validators.Set("ETag", fmt.Sprintf(`"%d-%s"`, version.Number, key[:16]))
+	validators.Set("Last-Modified", version.UpdatedAt.UTC().Format(http.TimeFormat))
+	if notModified(r, validators.Get("ETag"), version.UpdatedAt) {
+		copyHeader(w.Header(), validators)
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if entry, ok := s.cache.Get(key); ok && entry.Version == version.Number {
+		copyHeader(w.Header(), entry.Header)
+		w.WriteHeader(entry.Status)
+		w.Write(entry.Body)
+		return
+	}
+
+	rec := &recorder{ResponseWriter: w, validators: validators, limit: s.cache.MaxEntryBytes()}
+	if respond(rec) && rec.status == http.StatusOK && !rec.overflow {
+		s.cache.Add(key, &cache.Entry{
+			Version: version.Number,
+			Status:  rec.status,
+			Header:  rec.header,
+			Body:    rec.body.Bytes(),
+		})
+	}
+}
+
+// datasetVersion reads the dataset version, at most once per
+// versionCheckInterval. Only one request reads it at a time, without holding
+// the lock; the others keep the last version read meanwhile, or wait for the
+// read if there is none yet.
+func (s *Server) datasetVersion(ctx context.Context) (datasetVersion, error) {
+	check := &s.version
+	check.mu.Lock()
+	if !check.checked.IsZero() && time.Since(check.checked) < versionCheckInterval {
+		defer check.mu.Unlock()
+		return check.version, check.err
+	}
+	if check.reading != nil {
+		if !check.checked.IsZero() && check.err == nil {
+			defer check.mu.Unlock()
+			return check.version, nil
+		}
+		reading := check.reading
+		check.mu.Unlock()
+		select {
+		case <-reading:
+		case <-ctx.Done():
+			return datasetVersion{}, ctx.Err()
+		}
+		check.mu.Lock()
+		defer check.mu.Unlock()
+		if check.checked.IsZero() {
+			return datasetVersion{}, errors.New("dataset version read was canceled")
+		}
+		return check.version, check.err
+	}
+	reading := make(chan struct{})
+	check.reading = reading
+	check.mu.Unlock()
+
+	version, err := s.queryVersion(ctx)
+
+	check.mu.Lock()
+	defer check.mu.Unlock()
+	check.reading = nil
+	close(reading)
+	if ctx.Err() != nil {
+		// Only this request gave up, so check again for the next one
+		return version, err
+	}
+	check.version = version
+	check.err = err
+	check.checked = time.Now()
+	return version, err
+}
+
+func (s *Server) queryVersion(ctx context.Context) (datasetVersion, error) {
+	version := datasetVersion{}
+	rows, err := s.QueryRows(ctx, query.NewRawSQL(sqlDatasetVersion))
+	if err != nil {
+		return version, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		err = rows.Err()
+		if err == nil {
+			err = errors.New("dataset_version is empty")
+		}
+		return version, err
+	}
+	err = rows.Scan(&version.Number, &version.UpdatedAt)
+	return version, err
+}
+
+// notModified checks If-None-Match, or If-Modified-Since without it
+func notModified(r *http.Request, etag string, updatedAt time.Time) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == etag || candidate == "*" {
+				return true
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	// HTTP dates have whole seconds
+	return !updatedAt.Truncate(time.Second).After(since)
+}
+
+func copyHeader(dst, src http.Header) {
+	for name, values := range src {
+		dst[name] = values
+	}
+}
+
+// recorder passes a response through while keeping a copy of it, up to limit
+// bytes of body. Successful responses get the validators as they start.
+type recorder struct {
+	http.ResponseWriter
+	validators http.Header
+	limit      int
+	status     int
+	header     http.Header
+	body       bytes.Buffer
+	overflow   bool
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	if rec.status != 0 {
+		return
+	}
+	rec.status = status
+	if status == http.StatusOK {
+		copyHeader(rec.Header(), rec.validators)
+	}
+	rec.header = rec.Header().Clone()
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	if !rec.overflow {
+		if rec.body.Len()+len(b) > rec.limit {
+			rec.overflow = true
+			rec.body = bytes.Buffer{}
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Flush keeps streamed responses streaming
+func (rec *recorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,126 @@
+package shared
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/tim-harding/fatal-encounters-server/cache"
+	"github.com/tim-harding/fatal-encounters-server/query"
+)
+
+func expectVersion(mock sqlmock.Sqlmock) {
+	updated := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(sqlDatasetVersion).
+		WillReturnRows(sqlmock.NewRows([]string{"version", "updated_at"}).AddRow(3, updated))
+}
+
+func TestCachesResponses(t *testing.T) {
+	s, mock := newServer(t)
+	expectVersion(mock)
+	mock.ExpectQuery("SELECT id FROM incident").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	q := query.NewSelectClause("incident", []string{"id"})
+
+	first := httptest.NewRecorder()
+	s.HandleRoute(first, httptest.NewRequest("GET", "/", nil), q, translateID)
+	second := httptest.NewRecorder()
+	s.HandleRoute(second, httptest.NewRequest("GET", "/", nil), q, translateID)
+
+	if second.Body.String() != first.Body.String() {
+		t.Errorf("Was `%s`;\nWant `%s`", second.Body.String(), first.Body.String())
+	}
+	if etag := second.Header().Get("ETag"); etag == "" || etag != first.Header().Get("ETag") {
+		t.Errorf("Was ETag `%s`;\nWant `%s`", etag, first.Header().Get("ETag"))
+	}
+	if modified := second.Header().Get("Last-Modified"); modified != "Wed, 01 Jan 2020 00:00:00 GMT" {
+		t.Errorf("Was `%s`;\nWant `Wed, 01 Jan 2020 00:00:00 GMT`", modified)
+	}
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	s, mock := newServer(t)
+	expectVersion(mock)
+	mock.ExpectQuery("SELECT id FROM incident").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	q := query.NewSelectClause("incident", []string{"id"})
+
+	first := httptest.NewRecorder()
+	s.HandleRoute(first, httptest.NewRequest("GET", "/", nil), q, translateID)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("If-None-Match", first.Header().Get("ETag"))
+	second := httptest.NewRecorder()
+	s.HandleRoute(second, r, q, translateID)
+
+	if second.Code != http.StatusNotModified {
+		t.Errorf("Was `%d`;\nWant `%d`", second.Code, http.StatusNotModified)
+	}
+	if second.Body.Len() != 0 {
+		t.Errorf("Was `%s`;\nWant an empty body", second.Body.String())
+	}
+}
+
+func TestSkipsCachingErrors(t *testing.T) {
+	s, mock := newServer(t)
+	expectVersion(mock)
+	mock.ExpectQuery("SELECT id FROM incident").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).RowError(1, errors.New("connection reset")))
+	mock.ExpectQuery("SELECT id FROM incident").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+	q := query.NewSelectClause("incident", []string{"id"})
+
+	for i := 0; i < 2; i++ {
+		s.HandleRoute(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), q, translateID)
+	}
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSkipsCachingLargeResponses(t *testing.T) {
+	s, mock := newServer(t)
+	s.cache = cache.New(1<<10, 4, time.Minute)
+	expectVersion(mock)
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT id FROM incident").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	}
+	q := query.NewSelectClause("incident", []string{"id"})
+
+	for i := 0; i < 2; i++ {
+		s.HandleRoute(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), q, translateID)
+	}
+	err := mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKeepsVersionWhileReading(t *testing.T) {
+	s, mock := newServer(t)
+	stale := datasetVersion{Number: 2}
+	s.version.version = stale
+	s.version.checked = time.Now().Add(-time.Minute)
+	s.version.reading = make(chan struct{})
+
+	version, err := s.datasetVersion(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != stale {
+		t.Errorf("Was `%v`;\nWant `%v`", version, stale)
+	}
+	err = mock.ExpectationsWereMet()
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,35 @@
+package shared
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+)
+
+// EncodeCursor creates an opaque page token from the position of the last row
+func EncodeCursor(position interface{}) string {
+	b, err := json.Marshal(position)
+	if err != nil {
+		// Positions are plain structs, so this is a programming error
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// DecodeCursor reads the `cursor` parameter into position,
+// returning false if there is none or it is invalid
+func DecodeCursor(r *http.Request, position interface{}) bool {
+	querystrings, ok := r.URL.Query()["cursor"]
+	if !ok || len(querystrings) < 1 {
+		return false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(querystrings[0])
+	if err == nil {
+		err = json.Unmarshal(b, position)
+	}
+	if err != nil {
+		InvalidParam(r, "cursor", "expected a nextCursor from a previous response")
+		return false
+	}
+	return true
+}
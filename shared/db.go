@@ -3,34 +3,44 @@ package shared
 import (
 	"database/sql"
 	"log"
+	"time"
 
 	// Import for postgres driver
 	_ "github.com/lib/pq"
+	"github.com/tim-harding/fatal-encounters-server/config"
 )
 
-// Db is the global database connection
-var Db *sql.DB
+const maxConnectBackoff = 30 * time.Second
 
-const connectString = `
-	host=localhost 
-	port=5432 
-	user=postgres 
-	password=postgres 
-	dbname=fatal_encounters 
-	sslmode=disable
-`
-
-func init() {
-	if db, err := sql.Open("postgres", connectString); err == nil {
-		Db = db
-	} else {
-		log.Fatal(err)
+// Connect opens the configured database and waits for it to accept
+// connections, retrying with exponential backoff
+func Connect(cfg config.Config) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return nil, err
 	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime.Duration)
 
-	err := Db.Ping()
-	if err != nil {
-		log.Fatal(err)
+	backoff := cfg.ConnectBackoff.Duration
+	for attempt := 1; ; attempt++ {
+		err = db.Ping()
+		if err == nil {
+			break
+		}
+		if attempt >= cfg.ConnectAttempts {
+			db.Close()
+			return nil, err
+		}
+		log.Printf("Database unavailable, retrying in %v: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxConnectBackoff {
+			backoff = maxConnectBackoff
+		}
 	}
 
 	log.Println("Connected to database")
+	return db, nil
 }
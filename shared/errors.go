@@ -0,0 +1,136 @@
+package shared
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// ErrorResponse is the JSON body sent with every error status
+type ErrorResponse struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Field   string       `json:"field,omitempty"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// FieldError describes one invalid request parameter
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// InternalError sends an internal server error message
+func InternalError(w http.ResponseWriter, err error) {
+	Error(w, err, http.StatusInternalServerError)
+}
+
+// QueryError sends an error response for a failed database query,
+// distinguishing timeouts and disconnected clients from other failures
+func QueryError(w http.ResponseWriter, r *http.Request, err error) {
+	switch r.Context().Err() {
+	case context.DeadlineExceeded:
+		Error(w, err, http.StatusServiceUnavailable)
+	case context.Canceled:
+		log.Printf("Request canceled: %v", err)
+	default:
+		InternalError(w, err)
+	}
+}
+
+// Error sends an error response
+func Error(w http.ResponseWriter, err error, code int) {
+	log.Printf("%v", err)
+	WriteError(w, ErrorResponse{
+		Code:    code,
+		Message: http.StatusText(code),
+	})
+}
+
+// FieldErrors sends a bad request response listing invalid parameters
+func FieldErrors(w http.ResponseWriter, details []FieldError) {
+	res := ErrorResponse{
+		Code:    http.StatusBadRequest,
+		Message: "Invalid request parameters",
+		Details: details,
+	}
+	if len(details) == 1 {
+		res.Field = details[0].Field
+		res.Message = details[0].Message
+	}
+	WriteError(w, res)
+}
+
+// WriteError sends the error envelope with its status code
+func WriteError(w http.ResponseWriter, res ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(res.Code)
+	json.NewEncoder(w).Encode(res)
+}
+
+// NotFound responds to unknown routes
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Error(w, fmt.Errorf("no route for %s", r.URL.Path), http.StatusNotFound)
+}
+
+// MethodNotAllowed responds to known routes requested with the wrong method
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Error(w, fmt.Errorf("%s not allowed for %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+}
+
+// Parameter validation
+// ------------------------------------------------------------
+
+type paramsKey struct{}
+
+// params collects the parameters that could not be parsed for a request
+type params struct {
+	strict bool
+	errors []FieldError
+}
+
+// ValidateParams creates middleware that tracks invalid query parameters.
+// In strict mode, off by default and turned on by the StrictParams setting or
+// `strict=true`, requests with invalid parameters are rejected rather than
+// answered with the parameters ignored.
+func (s *Server) ValidateParams(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := &params{strict: s.Config.StrictParams}
+		querystrings, ok := r.URL.Query()["strict"]
+		if ok && len(querystrings) > 0 {
+			strict, err := strconv.ParseBool(querystrings[0])
+			if err == nil {
+				p.strict = strict
+			} else {
+				p.strict = true
+				p.errors = append(p.errors, FieldError{"strict", "expected true or false"})
+			}
+		}
+		ctx := context.WithValue(r.Context(), paramsKey{}, p)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// InvalidParam records that a query parameter was ignored
+func InvalidParam(r *http.Request, field, message string) {
+	p, ok := r.Context().Value(paramsKey{}).(*params)
+	if ok {
+		p.errors = append(p.errors, FieldError{field, message})
+	}
+}
+
+// CheckParams responds with a bad request and returns false if the request
+// is in strict mode and any of its parameters were invalid
+func CheckParams(w http.ResponseWriter, r *http.Request) bool {
+	p, ok := r.Context().Value(paramsKey{}).(*params)
+	if !ok || !p.strict || len(p.errors) == 0 {
+		return true
+	}
+	log.Printf("Invalid parameters: %v", p.errors)
+	FieldErrors(w, p.errors)
+	return false
+}
@@ -1,8 +1,8 @@
 package shared
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
@@ -19,89 +19,86 @@ type QueryBuilderFunc func(r *http.Request) query.Clauser
 // RowTranslatorFunc creates a row of JSON response from a database row
 type RowTranslatorFunc func(rows *sql.Rows) (interface{}, error)
 
-type response struct {
-	Rows []interface{} `json:"rows"`
+// Envelope describes the JSON object that holds the rows of a response
+type Envelope struct {
+	ContentType string
+	// RowsKey names the array of rows
+	RowsKey string
+	// Fields are sent alongside the rows
+	Fields map[string]interface{}
+	// Trailer gets fields that depend on the rows, sent after them
+	Trailer func() map[string]interface{}
 }
 
-func newResponse() response {
-	return response{[]interface{}{}}
-}
+// RowsEnvelope is the default `{"rows": [...]}` response
+var RowsEnvelope = Envelope{"application/json", "rows", nil, nil}
 
 // HandleRoute responds to queries
-func HandleRoute(w http.ResponseWriter, r *http.Request, query query.Clauser, rowTranslator RowTranslatorFunc) {
-	res, err := buildResponse(query, rowTranslator)
-	if err != nil {
-		InternalError(w, err)
-		return
-	}
-	json.NewEncoder(w).Encode(res)
+func (s *Server) HandleRoute(w http.ResponseWriter, r *http.Request, query query.Clauser, rowTranslator RowTranslatorFunc) {
+	s.HandleEnvelopeRoute(w, r, query, rowTranslator, RowsEnvelope)
 }
 
-// InternalError sends an internal server error message
-func InternalError(w http.ResponseWriter, err error) {
-	Error(w, err, http.StatusInternalServerError)
+// HandleEnvelopeRoute responds to queries with the rows wrapped in the given envelope.
+// Rows are written as they are scanned. Once the first row is sent the status
+// can no longer change, so a later failure ends the rows early and adds an
+// `error` field holding the error envelope.
+func (s *Server) HandleEnvelopeRoute(w http.ResponseWriter, r *http.Request, query query.Clauser, rowTranslator RowTranslatorFunc, envelope Envelope) {
+	s.Cached(w, r, query, func(w http.ResponseWriter) bool {
+		return s.writeEnvelope(w, r, query, rowTranslator, envelope)
+	})
 }
 
-// Error sends an error response
-func Error(w http.ResponseWriter, err error, code int) {
-	log.Printf("%v", err)
-	message := http.StatusText(code)
-	http.Error(w, message, code)
-}
-
-func buildResponse(query query.Clauser, rowTranslator RowTranslatorFunc) (interface{}, error) {
-	queryString := query.String()
-	log.Printf("Database query: %s", queryString)
-
-	rows, err := Db.Query(queryString, query.Parameters()...)
+// writeEnvelope runs the query for HandleEnvelopeRoute,
+// returning whether the whole response was written
+func (s *Server) writeEnvelope(w http.ResponseWriter, r *http.Request, query query.Clauser, rowTranslator RowTranslatorFunc, envelope Envelope) bool {
+	rows, err := s.QueryRows(r.Context(), query)
 	if err != nil {
-		return nil, err
+		QueryError(w, r, err)
+		return false
 	}
-
 	defer rows.Close()
 
-	res, err := rowsToResponse(rows, rowTranslator)
+	// Most failures happen by the first row and still get a status code
+	row, ok, err := nextRow(rows, rowTranslator)
 	if err != nil {
-		return nil, err
+		QueryError(w, r, err)
+		return false
 	}
 
-	err = rows.Err()
-	if err != nil {
-		return nil, err
+	w.Header().Set("Content-Type", envelope.ContentType)
+	writer := newEnvelopeWriter(w, envelope)
+	writer.begin()
+	for ok && err == nil {
+		err = writer.row(row)
+		if err == nil {
+			row, ok, err = nextRow(rows, rowTranslator)
+		}
 	}
-
-	return res, nil
-}
-
-func rowsToResponse(rows *sql.Rows, rowTranslator RowTranslatorFunc) (interface{}, error) {
-	res := newResponse()
-	for rows.Next() {
-		row, err := rowTranslator(rows)
-		if err != nil {
-			return nil, err
+	if writer.err != nil {
+		log.Printf("Response interrupted: %v", writer.err)
+		return false
+	}
+	if err != nil {
+		if res := StreamError(r, err); res != nil {
+			writer.end(res)
 		}
-		res.Rows = append(res.Rows, row)
+		return false
 	}
-	return res, nil
+	writer.end(nil)
+	return writer.err == nil
 }
 
-// LimitClause creates a limit clause from the request
-func LimitClause(r *http.Request) query.Clauser {
-	limit := QueryInt(r, "count", 6)
-	page := QueryInt(r, "page", 0)
-	offset := page * limit
-	clause := query.NewPageClause(limit, offset)
-	return clause
+// QueryRows logs and runs a query, leaving the rows for the caller to close
+func (s *Server) QueryRows(ctx context.Context, query query.Clauser) (*sql.Rows, error) {
+	queryString := query.String()
+	log.Printf("Database query: %s", queryString)
+	return s.Store.QueryContext(ctx, queryString, query.Parameters()...)
 }
 
 // QueryInt gets an integer value from the request query string
 func QueryInt(r *http.Request, key string, defaultValue int) int {
-	querystrings, ok := r.URL.Query()[key]
-	if !ok || len(querystrings) < 1 {
-		return defaultValue
-	}
-	value, err := strconv.Atoi(querystrings[0])
-	if err != nil {
+	ok, value := MaybeQueryInt(r, key)
+	if !ok {
 		return defaultValue
 	}
 	return value
@@ -115,23 +112,30 @@ func MaybeQueryInt(r *http.Request, key string) (bool, int) {
 	}
 	integer, err := strconv.Atoi(querystrings[0])
 	if err != nil {
+		InvalidParam(r, key, "expected an integer")
 		return false, -1
 	}
 	return true, integer
 }
 
-// SearchClause creates a text search clause based on the `name` column
-func SearchClause(r *http.Request) query.Clauser {
+// SearchClause creates a text search clause based on the given name column
+func SearchClause(r *http.Request, column string) query.Clauser {
 	strings, ok := r.URL.Query()["search"]
 	if !ok || len(strings) < 1 {
 		return nil
 	}
-	return query.NewTextSearchClause("name", strings[0])
+	return query.NewTextSearchClause(column, strings[0])
 }
 
 // InClause creates an IN clause from the request
 func InClause(r *http.Request, column string) query.Clauser {
-	values := queryInts(r, column)
+	return InClauseFor(r, column, column)
+}
+
+// InClauseFor creates an IN clause on column from the request's key,
+// for columns that must be qualified with their table
+func InClauseFor(r *http.Request, key, column string) query.Clauser {
+	values := queryInts(r, key)
 	return query.NewInClause(column, values)
 }
 
@@ -145,6 +149,8 @@ func queryInts(r *http.Request, key string) []int {
 				integer, err := strconv.Atoi(part)
 				if err == nil {
 					mask = append(mask, integer)
+				} else {
+					InvalidParam(r, key, "expected comma-separated integers")
 				}
 			}
 		}
@@ -153,13 +159,14 @@ func queryInts(r *http.Request, key string) []int {
 }
 
 // HandleIDRoute creates a handler function for ID routes
-func HandleIDRoute(w http.ResponseWriter, r *http.Request, selectClause query.Clauser, rowTranslator RowTranslatorFunc, table string) {
+func (s *Server) HandleIDRoute(w http.ResponseWriter, r *http.Request, selectClause query.Clauser, rowTranslator RowTranslatorFunc, table string) {
 	query, err := buildWhereQuery(selectClause, r, table)
 	if err != nil {
-		Error(w, err, http.StatusBadRequest)
+		log.Printf("%v", err)
+		FieldErrors(w, []FieldError{{"id", "expected comma-separated integers"}})
 		return
 	}
-	HandleRoute(w, r, query, rowTranslator)
+	s.HandleRoute(w, r, query, rowTranslator)
 }
 
 func buildWhereQuery(base query.Clauser, r *http.Request, table string) (query.Clauser, error) {
@@ -0,0 +1,70 @@
+package shared
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/tim-harding/fatal-encounters-server/openapi"
+)
+
+var errorSchema = openapi.Named("Error", openapi.SchemaOf(ErrorResponse{}))
+
+// Responses documents a JSON success body alongside the error envelope
+func Responses(description string, body *openapi.Schema) map[string]*openapi.Response {
+	return openapi.Responses(openapi.JSON(description, body), errorSchema)
+}
+
+// ListResponses documents a `{"rows": [...]}` response
+func ListResponses(description string, row *openapi.Schema) map[string]*openapi.Response {
+	body := openapi.Object(map[string]*openapi.Schema{
+		"rows": openapi.Array(row),
+	})
+	return Responses(description, body)
+}
+
+// PagedListResponses documents the response of HandleListRoute,
+// where the page fields are only sent with includeTotal=true
+func PagedListResponses(description string, row *openapi.Schema) map[string]*openapi.Response {
+	responses := ListResponses(description, row)
+	body := responses["200"].Content["application/json"].Schema
+	body.Properties["total"] = openapi.Integer()
+	body.Properties["page"] = openapi.Integer()
+	body.Properties["count"] = openapi.Integer()
+	body.Properties["hasMore"] = openapi.Boolean()
+	return responses
+}
+
+// IncludeTotalParameter documents the parameter read by IncludeTotal
+func IncludeTotalParameter() openapi.Parameter {
+	return openapi.Query("includeTotal", "Add the total, page, count and hasMore fields", openapi.Boolean())
+}
+
+// ListParameters documents the parameters read by PickPage,
+// IncludeTotal, SearchClause and IgnoreClause
+func ListParameters() []openapi.Parameter {
+	return []openapi.Parameter{
+		openapi.Query("count", "Rows per page, or all rows if less than one. Defaults to 6.", openapi.Integer()),
+		openapi.Query("page", "Zero-based page number", openapi.Integer()),
+		IncludeTotalParameter(),
+		openapi.Query("search", "Case insensitive substring of the name", openapi.String()),
+		openapi.QueryList("ignore", "IDs to leave out", openapi.Integer()),
+	}
+}
+
+// IDParameter documents the {id} path parameter read by HandleIDRoute
+func IDParameter() openapi.Parameter {
+	return openapi.PathList("id", "Comma-separated IDs", openapi.Integer())
+}
+
+// StrictParameter documents the parameter read by ValidateParams
+func StrictParameter() openapi.Parameter {
+	return openapi.Query("strict", "Reject the request if any parameter is invalid", openapi.Boolean())
+}
+
+// HandleDocument serves an OpenAPI document
+func HandleDocument(doc *openapi.Document) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(doc)
+	}
+}
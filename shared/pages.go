@@ -0,0 +1,134 @@
+package shared
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/tim-harding/fatal-encounters-server/query"
+)
+
+// Page is the slice of rows asked for with the count and page parameters
+type Page struct {
+	// Count is the number of rows per page, or less than one for every row
+	Count int
+	// Page is the zero-based page number
+	Page int
+}
+
+// PickPage reads the count and page parameters
+func PickPage(r *http.Request) Page {
+	return Page{
+		Count: QueryInt(r, "count", 6),
+		Page:  QueryInt(r, "page", 0),
+	}
+}
+
+// Clause creates the LIMIT and OFFSET for the page
+func (p Page) Clause() query.Clauser {
+	return query.NewPageClause(p.Count, p.Page*p.Count)
+}
+
+// hasMore is whether rows remain after the page
+func (p Page) hasMore(total int) bool {
+	return p.Count > 0 && (p.Page+1)*p.Count < total
+}
+
+// IncludeTotal reads the includeTotal parameter
+func IncludeTotal(r *http.Request) bool {
+	querystrings, ok := r.URL.Query()["includeTotal"]
+	if !ok || len(querystrings) < 1 {
+		return false
+	}
+	include, err := strconv.ParseBool(querystrings[0])
+	if err != nil {
+		InvalidParam(r, "includeTotal", "expected true or false")
+		return false
+	}
+	return include
+}
+
+// HandleListRoute responds with a page of the rows picked by from, which
+// selects and filters them, sorted by order. With includeTotal=true the
+// response also has total, page, count and hasMore, and Link headers
+// point to the neighboring pages.
+func (s *Server) HandleListRoute(w http.ResponseWriter, r *http.Request, from, order query.Clauser, rowTranslator RowTranslatorFunc) {
+	page := PickPage(r)
+	q := query.NewQuery()
+	q.AddClause(from)
+	q.AddClause(order)
+	q.AddClause(page.Clause())
+	if !IncludeTotal(r) {
+		s.HandleRoute(w, r, q, rowTranslator)
+		return
+	}
+	s.Cached(w, r, q, func(w http.ResponseWriter) bool {
+		total, err := s.countRows(r.Context(), from)
+		if err != nil {
+			QueryError(w, r, err)
+			return false
+		}
+		setLinks(w, r, page, total)
+		envelope := RowsEnvelope
+		envelope.Fields = map[string]interface{}{
+			"total":   total,
+			"page":    page.Page,
+			"count":   page.Count,
+			"hasMore": page.hasMore(total),
+		}
+		return s.writeEnvelope(w, r, q, rowTranslator, envelope)
+	})
+}
+
+// countRows counts the rows a query would return
+func (s *Server) countRows(ctx context.Context, from query.Clauser) (int, error) {
+	q := query.NewQuery()
+	q.AddClause(query.NewRawSQL("SELECT COUNT(1) FROM"))
+	q.AddClause(query.NewSubquery(from))
+	q.AddClause(query.NewRawSQL("AS counted"))
+	return s.queryCount(ctx, q)
+}
+
+// queryCount runs a query that returns a single integer
+func (s *Server) queryCount(ctx context.Context, q query.Clauser) (int, error) {
+	rows, err := s.QueryRows(ctx, q)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	var value int
+	if rows.Next() {
+		err = rows.Scan(&value)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return value, rows.Err()
+}
+
+// setLinks sets a Link header with the previous and next pages
+func setLinks(w http.ResponseWriter, r *http.Request, page Page, total int) {
+	if page.Count < 1 {
+		return
+	}
+	links := []string{}
+	if page.Page > 0 {
+		links = append(links, pageLink(r, page.Page-1, "prev"))
+	}
+	if page.hasMore(total) {
+		links = append(links, pageLink(r, page.Page+1, "next"))
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+}
+
+func pageLink(r *http.Request, page int, rel string) string {
+	u := *r.URL
+	values := u.Query()
+	values.Set("page", strconv.Itoa(page))
+	u.RawQuery = values.Encode()
+	return fmt.Sprintf(`<%s>; rel="%s"`, u.RequestURI(), rel)
+}
@@ -0,0 +1,60 @@
+package shared
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+
+	"github.com/go-chi/chi"
+
+	"github.com/tim-harding/fatal-encounters-server/cache"
+	"github.com/tim-harding/fatal-encounters-server/config"
+)
+
+// Store is the database the handlers query. *sql.DB satisfies it.
+type Store interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// Server holds the dependencies shared by the route handlers
+type Server struct {
+	Store  Store
+	Config config.Config
+	// cache is nil when caching is disabled
+	cache   *cache.Cache
+	version versionCheck
+}
+
+// NewServer creates a server that answers queries from the given store
+func NewServer(store Store, cfg config.Config) *Server {
+	s := &Server{Store: store, Config: cfg}
+	if cfg.CacheSize > 0 && cfg.CacheTTL.Duration > 0 {
+		s.cache = cache.New(cfg.CacheSize, cfg.CacheEntrySize, cfg.CacheTTL.Duration)
+	}
+	return s
+}
+
+// Use adds the middleware every route needs
+func (s *Server) Use(r chi.Router) {
+	r.NotFound(NotFound)
+	r.MethodNotAllowed(MethodNotAllowed)
+	r.Use(s.ValidateParams)
+}
+
+// Timeout creates middleware that cancels the request context, and with it
+// any running queries, after the configured timeout for the route
+func (s *Server) Timeout(route string) func(http.Handler) http.Handler {
+	timeout := s.Config.Timeout(route)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if timeout <= 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
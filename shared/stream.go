@@ -0,0 +1,150 @@
+package shared
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// streamFlushRows is how many rows are written between flushes
+const streamFlushRows = 100
+
+// envelopeWriter writes an envelope to the response one row at a time.
+// Keys are written in sorted order, matching encoding/json for maps.
+type envelopeWriter struct {
+	w        http.ResponseWriter
+	flusher  http.Flusher
+	envelope Envelope
+	keys     []string
+	count    int
+	// err is the first failed write, after which nothing more is written
+	err error
+}
+
+func newEnvelopeWriter(w http.ResponseWriter, envelope Envelope) *envelopeWriter {
+	keys := []string{}
+	for key := range envelope.Fields {
+		if key != envelope.RowsKey {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	flusher, _ := w.(http.Flusher)
+	return &envelopeWriter{w: w, flusher: flusher, envelope: envelope, keys: keys}
+}
+
+// begin writes the fields that sort before the rows and opens the rows array
+func (e *envelopeWriter) begin() {
+	e.write([]byte("{"))
+	for _, key := range e.keys {
+		if key < e.envelope.RowsKey {
+			e.field(key, e.envelope.Fields[key])
+			e.write([]byte(","))
+		}
+	}
+	e.key(e.envelope.RowsKey)
+	e.write([]byte("["))
+}
+
+func (e *envelopeWriter) row(row interface{}) error {
+	b, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if e.count > 0 {
+		e.write([]byte(","))
+	}
+	e.write(b)
+	e.count++
+	if e.count%streamFlushRows == 0 {
+		e.flush()
+	}
+	return e.err
+}
+
+// end closes the rows array and writes the remaining fields and trailer,
+// or the error in place of the trailer if the rows were cut short
+func (e *envelopeWriter) end(res *ErrorResponse) {
+	e.write([]byte("]"))
+	for _, key := range e.keys {
+		if key > e.envelope.RowsKey {
+			e.write([]byte(","))
+			e.field(key, e.envelope.Fields[key])
+		}
+	}
+	if res != nil {
+		e.write([]byte(","))
+		e.field("error", res)
+	} else if e.envelope.Trailer != nil {
+		trailer := e.envelope.Trailer()
+		keys := []string{}
+		for key := range trailer {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			e.write([]byte(","))
+			e.field(key, trailer[key])
+		}
+	}
+	e.write([]byte("}\n"))
+	e.flush()
+}
+
+func (e *envelopeWriter) key(key string) {
+	b, _ := json.Marshal(key)
+	e.write(b)
+	e.write([]byte(":"))
+}
+
+func (e *envelopeWriter) field(key string, value interface{}) {
+	e.key(key)
+	b, err := json.Marshal(value)
+	if err != nil {
+		b = []byte("null")
+		log.Printf("Envelope field %s: %v", key, err)
+	}
+	e.write(b)
+}
+
+func (e *envelopeWriter) write(b []byte) {
+	if e.err == nil {
+		_, e.err = e.w.Write(b)
+	}
+}
+
+func (e *envelopeWriter) flush() {
+	if e.err == nil && e.flusher != nil {
+		e.flusher.Flush()
+	}
+}
+
+// nextRow translates the next row, returning false once the rows run out
+func nextRow(rows *sql.Rows, rowTranslator RowTranslatorFunc) (interface{}, bool, error) {
+	if !rows.Next() {
+		return nil, false, rows.Err()
+	}
+	row, err := rowTranslator(rows)
+	return row, err == nil, err
+}
+
+// StreamError creates the error sent after the rows when a response fails
+// partway through, or nil if the client has gone and nothing should be sent
+func StreamError(r *http.Request, err error) *ErrorResponse {
+	code := http.StatusInternalServerError
+	switch r.Context().Err() {
+	case context.DeadlineExceeded:
+		code = http.StatusServiceUnavailable
+	case context.Canceled:
+		log.Printf("Request canceled: %v", err)
+		return nil
+	}
+	log.Printf("Response interrupted: %v", err)
+	return &ErrorResponse{
+		Code:    code,
+		Message: http.StatusText(code),
+	}
+}
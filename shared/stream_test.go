@@ -0,0 +1,73 @@
+package shared
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/tim-harding/fatal-encounters-server/config"
+	"github.com/tim-harding/fatal-encounters-server/query"
+)
+
+func newServer(t *testing.T) (*Server, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return NewServer(db, config.Default()), mock
+}
+
+func translateID(rows *sql.Rows) (interface{}, error) {
+	var id int
+	err := rows.Scan(&id)
+	return id, err
+}
+
+func TestEnvelopeFieldsAroundRows(t *testing.T) {
+	s, mock := newServer(t)
+	mock.ExpectQuery("SELECT id FROM incident").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2))
+
+	envelope := Envelope{"application/json", "ids", map[string]interface{}{"type": "<b>", "count": 2}, nil}
+	w := httptest.NewRecorder()
+	s.HandleEnvelopeRoute(w, httptest.NewRequest("GET", "/", nil), query.NewSelectClause("incident", []string{"id"}), translateID, envelope)
+
+	const wanted = `{"count":2,"ids":[1,2],"type":"\u003cb\u003e"}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+}
+
+func TestErrorAfterFirstRow(t *testing.T) {
+	s, mock := newServer(t)
+	mock.ExpectQuery("SELECT id FROM incident").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).RowError(1, errors.New("connection reset")))
+
+	w := httptest.NewRecorder()
+	s.HandleRoute(w, httptest.NewRequest("GET", "/", nil), query.NewSelectClause("incident", []string{"id"}), translateID)
+
+	const wanted = `{"rows":[1],"error":{"code":500,"message":"Internal Server Error"}}` + "\n"
+	if w.Body.String() != wanted {
+		t.Errorf("Was `%s`;\nWant `%s`", w.Body.String(), wanted)
+	}
+	if w.Code != http.StatusOK {
+		t.Errorf("Was `%d`;\nWant `%d`", w.Code, http.StatusOK)
+	}
+}
+
+func TestErrorBeforeFirstRow(t *testing.T) {
+	s, mock := newServer(t)
+	mock.ExpectQuery("SELECT id FROM incident").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).RowError(0, errors.New("connection reset")))
+
+	w := httptest.NewRecorder()
+	s.HandleRoute(w, httptest.NewRequest("GET", "/", nil), query.NewSelectClause("incident", []string{"id"}), translateID)
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Was `%d`;\nWant `%d`", w.Code, http.StatusInternalServerError)
+	}
+}